@@ -1,8 +1,12 @@
 package api
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/lovego/goa"
@@ -56,7 +60,7 @@ func HandleListJobsRequest(cache job.JobCache) func(c *goa.Context) {
 
 		resp := &types.ListJobsResponse{Jobs: make(map[string]*types.Job)}
 		for k := range allJobs.Jobs {
-			resp.Jobs[k] = allJobs.Jobs[k].Job
+			resp.Jobs[k] = job.Redacted(allJobs.Jobs[k].Job)
 		}
 		if err := job.JobsRunning(resp.Jobs); err != nil {
 			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
@@ -110,6 +114,29 @@ func HandleAddOrUpdateJob(cache job.JobCache, defaultOwner string) func(*goa.Con
 	}
 }
 
+// HandleSchedulePreviewRequest is the handler for previewing the run times of a schedule
+// POST /api/v1/job/preview
+func HandleSchedulePreviewRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		preview := &types.SchedulePreview{}
+		if err := json.Unmarshal(body, preview); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		runTimes, err := job.PreviewSchedule(preview)
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.SchedulePreviewResponse{RunTimes: runTimes})
+	}
+}
+
 // HandleJobGetRequest routes requests to /api/v1/job/{id} to GET a job.
 func HandleJobGetRequest(cache job.JobCache) func(c *goa.Context) {
 	return func(c *goa.Context) {
@@ -124,7 +151,7 @@ func HandleJobGetRequest(cache job.JobCache) func(c *goa.Context) {
 			c.WriteHeader(http.StatusNoContent)
 			return
 		}
-		c.StatusJson(http.StatusOK, &types.JobResponse{Job: j.Job})
+		c.StatusJson(http.StatusOK, &types.JobResponse{Job: job.Redacted(j.Job)})
 	}
 }
 
@@ -173,13 +200,125 @@ func HandleStartJobRequest(cache job.JobCache) func(c *goa.Context) {
 			c.WriteHeader(http.StatusNotFound)
 			return
 		}
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		req := &types.StartJobRequest{}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if err := json.Unmarshal(body, req); err != nil {
+				c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+				return
+			}
+		}
 
 		j.StopTimer()
-		j.Run(cache)
+		j.RunWithParams(cache, req.Params)
+		c.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleCancelJobRequest is the handler for cancelling the running attempt of jobs
+// /api/v1/job/cancel/{id}
+func HandleCancelJobRequest(cache job.JobCache) func(c *goa.Context) {
+	return func(c *goa.Context) {
+		id := c.Param(0)
+		j, err := cache.Get(id)
+		if err != nil || j == nil {
+			c.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if err := j.Cancel(); err == job.ErrJobNotRunning {
+			c.StatusJson(http.StatusConflict, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
 		c.WriteHeader(http.StatusOK)
 	}
 }
 
+// HandleFollowJobLogRequest is the handler for following the output of the running attempt of jobs,
+// as Server-Sent Events with the LogChunk as data, and an "end" event at the end of the attempt.
+// /api/v1/job/log/{id}
+func HandleFollowJobLogRequest(cache job.JobCache) func(c *goa.Context) {
+	return func(c *goa.Context) {
+		id := c.Param(0)
+		j, err := cache.Get(id)
+		if err != nil || j == nil {
+			c.WriteHeader(http.StatusNotFound)
+			return
+		}
+		log := j.RunLog()
+		if log == nil {
+			c.StatusJson(http.StatusConflict, apiError{Error: job.ErrJobNotRunning.Error()})
+			return
+		}
+
+		// Resume after the last chunk received by a reconnecting follower.
+		var from int64
+		if lastId, err := strconv.ParseInt(c.Request.Header.Get("Last-Event-ID"), 10, 64); err == nil {
+			from = lastId + 1
+		}
+		w := c.ResponseWriter
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		c.Flush()
+
+		err = log.Follow(c.Request.Context(), from, func(chunk types.LogChunk) error {
+			data, err := json.Marshal(chunk)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", chunk.Seq, chunk.Stream, data); err != nil {
+				return err
+			}
+			c.Flush()
+			return nil
+		})
+		if err == nil {
+			fmt.Fprint(w, "event: end\ndata: {}\n\n")
+			c.Flush()
+		}
+	}
+}
+
+// HandleGetRunLogRequest is the handler for getting the full output of a run of jobs
+// /api/v1/job/{id}/runs/{runId}/log
+func HandleGetRunLogRequest(cache job.JobCache) func(c *goa.Context) {
+	return func(c *goa.Context) {
+		id := c.Param(0)
+		j, err := cache.Get(id)
+		if err != nil || j == nil {
+			c.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if job.LogStore == nil {
+			c.StatusJson(http.StatusNotFound, apiError{Error: job.ErrRunLogDoesntExist.Error()})
+			return
+		}
+		log, err := job.LogStore.Open(id, c.Param(1))
+		if err == job.ErrRunLogDoesntExist || err == job.ErrInvalidRunId {
+			c.StatusJson(http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		defer log.Close()
+
+		c.ResponseWriter.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		c.ResponseWriter.WriteHeader(http.StatusOK)
+		if _, err := io.Copy(c.ResponseWriter, log); err != nil {
+			job.Logger.Errorf("Error writing the log of run %s of job %s: %s", c.Param(1), id, err)
+		}
+	}
+}
+
 // HandleDisableJobRequest is the handler for mdisabling jobs
 // /api/v1/job/disable/{id}
 func HandleDisableJobRequest(cache job.JobCache) func(c *goa.Context) {
@@ -218,10 +357,286 @@ func HandleEnableJobRequest(cache job.JobCache) func(c *goa.Context) {
 	}
 }
 
+// HandleSetCalendarRequest is the handler for creating or replacing a blackout calendar
+// POST /api/v1/calendar
+func HandleSetCalendarRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		calendar := &types.Calendar{}
+		if err := json.Unmarshal(body, calendar); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if err := job.SetCalendar(calendar); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusCreated, &types.CalendarResponse{Calendar: calendar})
+	}
+}
+
+// HandleImportCalendarRequest is the handler for importing the events of an iCalendar file
+// into the date ranges of a blackout calendar
+// POST /api/v1/calendar/{name}/ics
+func HandleImportCalendarRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		calendar, err := job.ImportCalendar(c.Param(0), bytes.NewReader(body))
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusCreated, &types.CalendarResponse{Calendar: calendar})
+	}
+}
+
+// HandleListCalendarsRequest is the handler for listing all blackout calendars
+// GET /api/v1/calendar
+func HandleListCalendarsRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		calendars, err := job.GetAllCalendars()
+		if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.ListCalendarsResponse{Calendars: calendars})
+	}
+}
+
+// HandleGetCalendarRequest is the handler for getting a blackout calendar
+// GET /api/v1/calendar/{name}
+func HandleGetCalendarRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		calendar, err := job.GetCalendar(c.Param(0))
+		if err == job.ErrCalendarDoesntExist {
+			c.StatusJson(http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.CalendarResponse{Calendar: calendar})
+	}
+}
+
+// HandleDeleteCalendarRequest is the handler for deleting a blackout calendar
+// DELETE /api/v1/calendar/{name}
+func HandleDeleteCalendarRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		if err := job.DeleteCalendar(c.Param(0)); err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleSetGroupRequest is the handler for creating or replacing the settings of a group
+// POST /api/v1/group
+func HandleSetGroupRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		group := &types.Group{}
+		if err := json.Unmarshal(body, group); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if err := job.SetGroup(group); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusCreated, &types.GroupResponse{Group: group})
+	}
+}
+
+// HandleListGroupsRequest is the handler for listing the settings of all groups
+// GET /api/v1/group
+func HandleListGroupsRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		groups, err := job.GetAllGroups()
+		if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.ListGroupsResponse{Groups: groups})
+	}
+}
+
+// HandleGetGroupRequest is the handler for getting the settings of a group
+// GET /api/v1/group/{name}
+func HandleGetGroupRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		group, err := job.GetGroup(c.Param(0))
+		if err == job.ErrGroupDoesntExist {
+			c.StatusJson(http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.GroupResponse{Group: group})
+	}
+}
+
+// HandleDeleteGroupRequest is the handler for deleting the settings of a group
+// DELETE /api/v1/group/{name}
+func HandleDeleteGroupRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		if err := job.DeleteGroup(c.Param(0)); err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleSetTransportRequest is the handler for creating or replacing a named transport
+// POST /api/v1/transport
+func HandleSetTransportRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		transport := &types.Transport{}
+		if err := json.Unmarshal(body, transport); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if err := job.SetTransport(transport); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusCreated, &types.TransportResponse{Transport: job.RedactedTransport(transport)})
+	}
+}
+
+// HandleListTransportsRequest is the handler for listing all named transports
+// GET /api/v1/transport
+func HandleListTransportsRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		transports, err := job.GetAllTransports()
+		if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		for name := range transports {
+			transports[name] = job.RedactedTransport(transports[name])
+		}
+		c.StatusJson(http.StatusOK, &types.ListTransportsResponse{Transports: transports})
+	}
+}
+
+// HandleGetTransportRequest is the handler for getting a named transport
+// GET /api/v1/transport/{name}
+func HandleGetTransportRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		transport, err := job.GetTransport(c.Param(0))
+		if err == job.ErrTransportDoesntExist {
+			c.StatusJson(http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.TransportResponse{Transport: job.RedactedTransport(transport)})
+	}
+}
+
+// HandleDeleteTransportRequest is the handler for deleting a named transport
+// DELETE /api/v1/transport/{name}
+func HandleDeleteTransportRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		if err := job.DeleteTransport(c.Param(0)); err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+}
+
+// HandleSetSecretRequest is the handler for creating or replacing a secret
+// POST /api/v1/secret
+func HandleSetSecretRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		body, err := c.RequestBody()
+		if err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		secret := &types.Secret{}
+		if err := json.Unmarshal(body, secret); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		if err := job.SetSecret(secret); err != nil {
+			c.StatusJson(http.StatusBadRequest, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusCreated, &types.SecretResponse{Secret: secret})
+	}
+}
+
+// HandleListSecretsRequest is the handler for listing all secrets, without their values
+// GET /api/v1/secret
+func HandleListSecretsRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		secrets, err := job.GetAllSecrets()
+		if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.ListSecretsResponse{Secrets: secrets})
+	}
+}
+
+// HandleGetSecretRequest is the handler for getting a secret, without its value
+// GET /api/v1/secret/{name}
+func HandleGetSecretRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		secret, err := job.GetSecret(c.Param(0))
+		if err == job.ErrSecretDoesntExist {
+			c.StatusJson(http.StatusNotFound, apiError{Error: err.Error()})
+			return
+		} else if err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.StatusJson(http.StatusOK, &types.SecretResponse{Secret: secret})
+	}
+}
+
+// HandleDeleteSecretRequest is the handler for deleting a secret
+// DELETE /api/v1/secret/{name}
+func HandleDeleteSecretRequest() func(c *goa.Context) {
+	return func(c *goa.Context) {
+		if err := job.DeleteSecret(c.Param(0)); err != nil {
+			c.StatusJson(http.StatusInternalServerError, apiError{Error: err.Error()})
+			return
+		}
+		c.WriteHeader(http.StatusOK)
+	}
+}
+
 // SetupApiRoutes is used within main to initialize all of the routes
 func SetupApiRoutes(router *goa.RouterGroup, cache job.JobCache, defaultOwner string) {
 	// Route for creating a job
 	router.Post(types.JobPath, HandleAddOrUpdateJob(cache, defaultOwner))
+	// Route for previewing the run times of a schedule
+	router.Post(types.JobPath+"/preview", HandleSchedulePreviewRequest())
 	// Route for deleting all jobs
 	router.Delete(types.JobPath+"/all", HandleDeleteAllJobs(cache))
 	// Route for deleting a job
@@ -234,10 +649,54 @@ func SetupApiRoutes(router *goa.RouterGroup, cache job.JobCache, defaultOwner st
 	router.Get(types.JobPath, HandleListJobsRequest(cache))
 	// Route for manually start a job
 	router.Post(types.JobPath+`/start/(\S{36})`, HandleStartJobRequest(cache))
+	// Route for cancelling the running attempt of a job
+	router.Post(types.JobPath+`/cancel/(\S{36})`, HandleCancelJobRequest(cache))
+	// Route for following the output of the running attempt of a job
+	router.Get(types.JobPath+`/log/(\S{36})`, HandleFollowJobLogRequest(cache))
+	// Route for getting the full output of a run of a job
+	router.Get(types.JobPath+`/(\S{36})/runs/(\S{36})/log`, HandleGetRunLogRequest(cache))
 	// Route for manually start a job
 	router.Post(types.JobPath+`/enable/(\S{36})`, HandleEnableJobRequest(cache))
 	// Route for manually disable a job
 	router.Post(types.JobPath+`/disable/(\S{36})`, HandleDisableJobRequest(cache))
 	// Route for getting app-level metrics
 	router.Get(`/stats`, HandleKalaStatsRequest(cache))
+
+	// Route for creating or replacing a blackout calendar
+	router.Post(types.CalendarPath, HandleSetCalendarRequest())
+	// Route for importing an iCalendar file into a blackout calendar
+	router.Post(types.CalendarPath+`/([^/]+)/ics`, HandleImportCalendarRequest())
+	// Route for listing all blackout calendars
+	router.Get(types.CalendarPath, HandleListCalendarsRequest())
+	// Route for getting a blackout calendar
+	router.Get(types.CalendarPath+`/([^/]+)`, HandleGetCalendarRequest())
+	// Route for deleting a blackout calendar
+	router.Delete(types.CalendarPath+`/([^/]+)`, HandleDeleteCalendarRequest())
+
+	// Route for creating or replacing the settings of a group
+	router.Post(types.GroupPath, HandleSetGroupRequest())
+	// Route for listing the settings of all groups
+	router.Get(types.GroupPath, HandleListGroupsRequest())
+	// Route for getting the settings of a group
+	router.Get(types.GroupPath+`/([^/]+)`, HandleGetGroupRequest())
+	// Route for deleting the settings of a group
+	router.Delete(types.GroupPath+`/([^/]+)`, HandleDeleteGroupRequest())
+
+	// Route for creating or replacing a named transport
+	router.Post(types.TransportPath, HandleSetTransportRequest())
+	// Route for listing all named transports
+	router.Get(types.TransportPath, HandleListTransportsRequest())
+	// Route for getting a named transport
+	router.Get(types.TransportPath+`/([^/]+)`, HandleGetTransportRequest())
+	// Route for deleting a named transport
+	router.Delete(types.TransportPath+`/([^/]+)`, HandleDeleteTransportRequest())
+
+	// Route for creating or replacing a secret
+	router.Post(types.SecretPath, HandleSetSecretRequest())
+	// Route for listing all secrets, without their values
+	router.Get(types.SecretPath, HandleListSecretsRequest())
+	// Route for getting a secret, without its value
+	router.Get(types.SecretPath+`/([^/]+)`, HandleGetSecretRequest())
+	// Route for deleting a secret
+	router.Delete(types.SecretPath+`/([^/]+)`, HandleDeleteSecretRequest())
 }
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -8,6 +9,7 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/lovego/kala/types"
 )
@@ -21,10 +23,16 @@ const (
 var (
 	ErrJobNotFound      = errors.New("Job not found")
 	ErrJobCreationError = errors.New("Error creating job")
+	ErrJobNotRunning    = errors.New("Job is not running")
+	ErrRunLogNotFound   = errors.New("Run log not found")
 
 	ErrGenericError = errors.New("An error occurred performing your request")
 
-	jobPath = types.JobPath
+	jobPath       = types.JobPath
+	calendarPath  = types.CalendarPath
+	groupPath     = types.GroupPath
+	transportPath = types.TransportPath
+	secretPath    = types.SecretPath
 )
 
 // KalaClient is the base struct for this package.
@@ -44,6 +52,9 @@ func (kc *KalaClient) encode(value interface{}) (io.Reader, error) {
 	if value == nil {
 		return nil, nil
 	}
+	if r, ok := value.(io.Reader); ok {
+		return r, nil
+	}
 	buf := new(bytes.Buffer)
 	if err := json.NewEncoder(buf).Encode(value); err != nil {
 		return nil, err
@@ -195,6 +206,138 @@ func (kc *KalaClient) StartJob(id string) (bool, error) {
 	return true, nil
 }
 
+// StartJobWithParams is used to manually start a Job by its ID, with the Params of its templates.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		id := "93b65499-b211-49ce-57e0-19e735cc5abd"
+//		ok, err := c.StartJobWithParams(id, map[string]string{"date": "2017-06-04"})
+func (kc *KalaClient) StartJobWithParams(id string, params map[string]string) (bool, error) {
+	req := &types.StartJobRequest{Params: params}
+	_, err := kc.do(methodPost, kc.url(jobPath, "start", id), http.StatusNoContent, req, nil)
+	if err != nil {
+		if err == ErrGenericError {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// CancelJob is used to cancel the running attempt of a Job by its ID.
+// It returns false if the Job isn't running.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		id := "93b65499-b211-49ce-57e0-19e735cc5abd"
+//		ok, err := c.CancelJob(id)
+func (kc *KalaClient) CancelJob(id string) (bool, error) {
+	status, err := kc.do(methodPost, kc.url(jobPath, "cancel", id), http.StatusOK, nil, nil)
+	if err != nil {
+		if err == ErrGenericError {
+			if status == http.StatusConflict {
+				return false, nil
+			}
+			return false, fmt.Errorf("Cancel failed with a status code of %d", status)
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// FollowJobLog calls handle with the output of the running attempt of a Job by its ID,
+// as it is written, until the attempt ends or handle returns an error.
+// It returns ErrJobNotRunning if the Job isn't running on the node answering.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		id := "93b65499-b211-49ce-57e0-19e735cc5abd"
+//		err := c.FollowJobLog(id, func(chunk types.LogChunk) error {
+//			fmt.Print(chunk.Data)
+//			return nil
+//		})
+func (kc *KalaClient) FollowJobLog(id string, handle func(types.LogChunk) error) error {
+	resp, err := http.Get(kc.url(jobPath, "log", id))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return ErrJobNotFound
+	case http.StatusConflict:
+		return ErrJobNotRunning
+	default:
+		return fmt.Errorf("Follow failed with a status code of %d", resp.StatusCode)
+	}
+
+	// Server-Sent Events, with a LogChunk as data.
+	var event, data string
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "":
+			if event == "end" {
+				return nil
+			}
+			if data != "" {
+				chunk := types.LogChunk{}
+				if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+					return err
+				}
+				if err := handle(chunk); err != nil {
+					return err
+				}
+			}
+			event, data = "", ""
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// GetRunLog is used to retrieve the full output of a run of a Job, by the Job's ID
+// and the RunId of the run's JobStat.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		id := "93b65499-b211-49ce-57e0-19e735cc5abd"
+//		stats, err := c.GetJobStats(id)
+//		log, err := c.GetRunLog(id, stats[0].RunId)
+func (kc *KalaClient) GetRunLog(id, runId string) ([]byte, error) {
+	resp, err := http.Get(kc.url(jobPath, id, "runs", runId, "log"))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrRunLogNotFound
+	} else if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Getting the run log failed with a status code of %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// PreviewSchedule returns the next run times of a schedule,
+// as they would be for a job created with it now.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		runTimes, err := c.PreviewSchedule(&types.SchedulePreview{
+//			Schedule: "R/2015-06-04T19:25:16.828696-07:00/P1D",
+//			TimeZone: "America/Los_Angeles",
+//			Count:    5,
+//		})
+func (kc *KalaClient) PreviewSchedule(preview *types.SchedulePreview) ([]time.Time, error) {
+	resp := &types.SchedulePreviewResponse{}
+	_, err := kc.do(methodPost, kc.url(jobPath, "preview"), http.StatusOK, preview, resp)
+	return resp.RunTimes, err
+}
+
 // GetKalaStats retrieves system-level metrics about Kala
 // Example:
 // 		c := New("http://127.0.0.1:8000")
@@ -236,3 +379,171 @@ func (kc *KalaClient) EnableJob(id string) (bool, error) {
 	}
 	return true, nil
 }
+
+// SetCalendar is used to create or replace a blackout calendar,
+// during which the jobs referencing it don't run.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.SetCalendar(&types.Calendar{
+//			Name:   "weekend",
+//			Weekly: []types.WeeklyWindow{{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: "00:00", End: "24:00"}},
+//		})
+func (kc *KalaClient) SetCalendar(calendar *types.Calendar) error {
+	_, err := kc.do(methodPost, kc.url(calendarPath), http.StatusCreated, calendar, nil)
+	return err
+}
+
+// ImportCalendar replaces the date ranges of a blackout calendar with the events
+// of an iCalendar file, creating the calendar if it doesn't exist.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		file, err := os.Open("holidays.ics")
+//		calendar, err := c.ImportCalendar("holidays", file)
+func (kc *KalaClient) ImportCalendar(name string, ics io.Reader) (*types.Calendar, error) {
+	resp := &types.CalendarResponse{}
+	_, err := kc.do(methodPost, kc.url(calendarPath, name, "ics"), http.StatusCreated, ics, resp)
+	return resp.Calendar, err
+}
+
+// GetCalendar is used to retrieve a blackout calendar by its name.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		calendar, err := c.GetCalendar("holidays")
+func (kc *KalaClient) GetCalendar(name string) (*types.Calendar, error) {
+	resp := &types.CalendarResponse{}
+	_, err := kc.do(methodGet, kc.url(calendarPath, name), http.StatusOK, nil, resp)
+	return resp.Calendar, err
+}
+
+// GetAllCalendars returns a map of names to all blackout calendars.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		calendars, err := c.GetAllCalendars()
+func (kc *KalaClient) GetAllCalendars() (map[string]*types.Calendar, error) {
+	resp := &types.ListCalendarsResponse{}
+	_, err := kc.do(methodGet, kc.url(calendarPath), http.StatusOK, nil, resp)
+	return resp.Calendars, err
+}
+
+// DeleteCalendar is used to delete a blackout calendar by its name.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.DeleteCalendar("holidays")
+func (kc *KalaClient) DeleteCalendar(name string) error {
+	_, err := kc.do(methodDelete, kc.url(calendarPath, name), http.StatusOK, nil, nil)
+	return err
+}
+
+// SetGroup is used to create or replace the settings of a group.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.SetGroup(&types.Group{Name: "reports", Calendars: []string{"holidays"}})
+func (kc *KalaClient) SetGroup(group *types.Group) error {
+	_, err := kc.do(methodPost, kc.url(groupPath), http.StatusCreated, group, nil)
+	return err
+}
+
+// GetGroup is used to retrieve the settings of a group by its name.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		group, err := c.GetGroup("reports")
+func (kc *KalaClient) GetGroup(name string) (*types.Group, error) {
+	resp := &types.GroupResponse{}
+	_, err := kc.do(methodGet, kc.url(groupPath, name), http.StatusOK, nil, resp)
+	return resp.Group, err
+}
+
+// GetAllGroups returns a map of names to the settings of all groups.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		groups, err := c.GetAllGroups()
+func (kc *KalaClient) GetAllGroups() (map[string]*types.Group, error) {
+	resp := &types.ListGroupsResponse{}
+	_, err := kc.do(methodGet, kc.url(groupPath), http.StatusOK, nil, resp)
+	return resp.Groups, err
+}
+
+// DeleteGroup is used to delete the settings of a group by its name.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.DeleteGroup("reports")
+func (kc *KalaClient) DeleteGroup(name string) error {
+	_, err := kc.do(methodDelete, kc.url(groupPath, name), http.StatusOK, nil, nil)
+	return err
+}
+
+// SetTransport is used to create or replace a named transport of remote jobs.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.SetTransport(&types.Transport{Name: "internal", CaCert: caPEM})
+func (kc *KalaClient) SetTransport(transport *types.Transport) error {
+	_, err := kc.do(methodPost, kc.url(transportPath), http.StatusCreated, transport, nil)
+	return err
+}
+
+// GetTransport is used to retrieve a named transport, without its client key.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		transport, err := c.GetTransport("internal")
+func (kc *KalaClient) GetTransport(name string) (*types.Transport, error) {
+	resp := &types.TransportResponse{}
+	_, err := kc.do(methodGet, kc.url(transportPath, name), http.StatusOK, nil, resp)
+	return resp.Transport, err
+}
+
+// GetAllTransports returns a map of names to all named transports, without their client keys.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		transports, err := c.GetAllTransports()
+func (kc *KalaClient) GetAllTransports() (map[string]*types.Transport, error) {
+	resp := &types.ListTransportsResponse{}
+	_, err := kc.do(methodGet, kc.url(transportPath), http.StatusOK, nil, resp)
+	return resp.Transports, err
+}
+
+// DeleteTransport is used to delete a named transport.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.DeleteTransport("internal")
+func (kc *KalaClient) DeleteTransport(name string) error {
+	_, err := kc.do(methodDelete, kc.url(transportPath, name), http.StatusOK, nil, nil)
+	return err
+}
+
+// SetSecret is used to create or replace a secret, referenced by the templates of jobs.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.SetSecret(&types.Secret{Name: "db_password", Value: "s3cr3t"})
+func (kc *KalaClient) SetSecret(secret *types.Secret) error {
+	_, err := kc.do(methodPost, kc.url(secretPath), http.StatusCreated, secret, nil)
+	return err
+}
+
+// GetSecret is used to retrieve a secret by its name, without its value.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		secret, err := c.GetSecret("db_password")
+func (kc *KalaClient) GetSecret(name string) (*types.Secret, error) {
+	resp := &types.SecretResponse{}
+	_, err := kc.do(methodGet, kc.url(secretPath, name), http.StatusOK, nil, resp)
+	return resp.Secret, err
+}
+
+// GetAllSecrets returns a map of names to all secrets, without their values.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		secrets, err := c.GetAllSecrets()
+func (kc *KalaClient) GetAllSecrets() (map[string]*types.Secret, error) {
+	resp := &types.ListSecretsResponse{}
+	_, err := kc.do(methodGet, kc.url(secretPath), http.StatusOK, nil, resp)
+	return resp.Secrets, err
+}
+
+// DeleteSecret is used to delete a secret by its name.
+// Example:
+// 		c := New("http://127.0.0.1:8000")
+//		err := c.DeleteSecret("db_password")
+func (kc *KalaClient) DeleteSecret(name string) error {
+	_, err := kc.do(methodDelete, kc.url(secretPath, name), http.StatusOK, nil, nil)
+	return err
+}
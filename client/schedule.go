@@ -15,6 +15,10 @@ type Schedule struct {
 	After     *time.Duration   `json:"after" comment:"Start datetime after now seconds"`
 	Interval  iso8601.Duration `json:"interval" comment:"Interval Between Runs"`
 	Repeat    uint             `json:"repeat" comment:"Number of times to repeat, 0 means forever"`
+	Cron      string           `json:"cron" comment:"Cron expression used instead of StartTime, After and Interval, e.g. 30 9 * * MON-FRI"`
+	TimeZone  string           `json:"timeZone" comment:"IANA time zone the schedule is evaluated in, e.g. Asia/Shanghai"`
+	End       *time2.Time      `json:"end" comment:"No run is scheduled after this time, 2006-01-02 15:04:05"`
+	Jitter    iso8601.Duration `json:"jitter" comment:"Maximum random delay of runs, fixed per job, e.g. PT5M"`
 }
 
 // Make Schedule for create job.
@@ -34,6 +38,14 @@ func (s Schedule) String() string {
 	return schedule
 }
 
+// Make Cron for create job, prefixed by the number of times to repeat.
+func (s Schedule) cron() string {
+	if s.Repeat <= 0 {
+		return s.Cron
+	}
+	return fmt.Sprintf("R%d/%s", s.Repeat, s.Cron)
+}
+
 func (s Schedule) startTime() time.Time {
 	if s.StartTime != nil && s.StartTime.Time.After(time.Now()) {
 		return s.StartTime.Time
@@ -60,12 +72,23 @@ func (s Scheduler) Job() *types.Job {
 		Owner:            s.Owner,
 		GroupName:        s.GroupName,
 		Content:          s.Content,
-		Schedule:         s.Schedule.String(),
 		Retries:          s.Retries,
+		TimeZone:         s.TimeZone,
 		JobType:          types.RemoteJob,
 		RemoteProperties: s.Remote,
 		CreatedAt:        time.Now().Round(time.Second),
 	}
+	if s.End != nil {
+		job.ScheduleEnd = s.End.Time
+	}
+	if !s.Jitter.IsZero() {
+		job.Jitter = s.Jitter.String()
+	}
+	if s.Cron != "" {
+		job.Cron = s.cron()
+	} else {
+		job.Schedule = s.Schedule.String()
+	}
 	if job.RemoteProperties.Headers == nil {
 		job.RemoteProperties.Headers = make(http.Header)
 	}
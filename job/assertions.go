@@ -0,0 +1,168 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lovego/kala/types"
+)
+
+// ErrResponseAssertion is the error of a remote job's response failing one of its ResponseAssertions.
+var ErrResponseAssertion = errors.New("Response assertion failed")
+
+func validateResponseAssertions(a *types.ResponseAssertions) error {
+	if a.BodyRegex != "" {
+		if _, err := regexp.Compile(a.BodyRegex); err != nil {
+			return fmt.Errorf("Invalid response body regexp: %v", err)
+		}
+	}
+	for _, field := range a.Json {
+		if _, err := parseJsonPath(field.Path); err != nil {
+			return err
+		}
+		var value interface{}
+		if err := json.Unmarshal(field.Value, &value); err != nil {
+			return fmt.Errorf("Invalid value of response field %s: %v", field.Path, err)
+		}
+	}
+	return nil
+}
+
+func hasResponseAssertions(a *types.ResponseAssertions) bool {
+	return len(a.Headers) > 0 || a.BodyRegex != "" || len(a.Json) > 0
+}
+
+// checkResponseAssertions returns an ErrResponseAssertion for the first assertion
+// the response doesn't hold.
+func checkResponseAssertions(a *types.ResponseAssertions, header http.Header, body []byte) error {
+	names := make([]string, 0, len(a.Headers))
+	for name := range a.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		values, ok := header[http.CanonicalHeaderKey(name)]
+		if !ok {
+			return fmt.Errorf("%w: header %s missing", ErrResponseAssertion, name)
+		}
+		if expected := a.Headers[name]; expected != "" && !containsString(values, expected) {
+			return fmt.Errorf("%w: header %s is %q, expected %q",
+				ErrResponseAssertion, name, strings.Join(values, ", "), expected)
+		}
+	}
+
+	if a.BodyRegex != "" {
+		re, err := regexp.Compile(a.BodyRegex)
+		if err != nil {
+			return err
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("%w: body doesn't match %s", ErrResponseAssertion, a.BodyRegex)
+		}
+	}
+
+	if len(a.Json) == 0 {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return fmt.Errorf("%w: body isn't JSON: %v", ErrResponseAssertion, err)
+	}
+	for _, field := range a.Json {
+		steps, err := parseJsonPath(field.Path)
+		if err != nil {
+			return err
+		}
+		var expected interface{}
+		if err := json.Unmarshal(field.Value, &expected); err != nil {
+			return err
+		}
+		actual, ok := lookupJson(doc, steps)
+		if !ok {
+			return fmt.Errorf("%w: field %s missing", ErrResponseAssertion, field.Path)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			b, _ := json.Marshal(actual)
+			return fmt.Errorf("%w: field %s is %s, expected %s", ErrResponseAssertion, field.Path, b, field.Value)
+		}
+	}
+	return nil
+}
+
+// parseJsonPath returns the steps of a JSONPath: the names of object children
+// and the indexes of array elements.
+func parseJsonPath(path string) ([]interface{}, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("Invalid JSONPath %s, it should start with $", path)
+	}
+	var steps []interface{}
+	for rest := path[1:]; rest != ""; {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[") + 1
+			if end == 0 {
+				end = len(rest)
+			}
+			if end == 1 {
+				return nil, fmt.Errorf("Invalid JSONPath %s, empty child name", path)
+			}
+			steps = append(steps, rest[1:end])
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("Invalid JSONPath %s, unclosed bracket", path)
+			}
+			inner := rest[1:end]
+			if n := len(inner); n >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[n-1] == inner[0] {
+				steps = append(steps, inner[1:n-1])
+			} else if i, err := strconv.Atoi(inner); err == nil && i >= 0 {
+				steps = append(steps, i)
+			} else {
+				return nil, fmt.Errorf("Invalid JSONPath %s, bad subscript [%s]", path, inner)
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("Invalid JSONPath %s, unexpected %q", path, rest[0])
+		}
+	}
+	return steps, nil
+}
+
+func lookupJson(v interface{}, steps []interface{}) (interface{}, bool) {
+	for _, step := range steps {
+		switch s := step.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[s]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || s >= len(a) {
+				return nil, false
+			}
+			v = a[s]
+		}
+	}
+	return v, true
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
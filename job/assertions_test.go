@@ -0,0 +1,94 @@
+package job
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseJsonPath(t *testing.T) {
+	steps, err := parseJsonPath(`$.data.items[1]['status']["x.y"]`)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"data", "items", 1, "status", "x.y"}, steps)
+
+	steps, err = parseJsonPath("$")
+	assert.NoError(t, err)
+	assert.Empty(t, steps)
+
+	for _, invalid := range []string{"data", "$..data", "$.items[", "$.items[-1]", "$.items[a]", "$ok"} {
+		_, err := parseJsonPath(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestCheckResponseAssertions(t *testing.T) {
+	header := http.Header{"Content-Type": {"application/json"}}
+	body := []byte(`{"ok": false, "data": {"count": 2, "items": [{"status": "done"}]}}`)
+	check := func(a types.ResponseAssertions) string {
+		assert.NoError(t, validateResponseAssertions(&a))
+		if err := checkResponseAssertions(&a, header, body); err != nil {
+			assert.ErrorIs(t, err, ErrResponseAssertion)
+			return err.Error()
+		}
+		return ""
+	}
+
+	assert.Equal(t, "", check(types.ResponseAssertions{
+		Headers:   map[string]string{"content-type": "application/json"},
+		BodyRegex: `"count":\s*2`,
+		Json: []types.JsonAssertion{
+			{Path: "$.ok", Value: json.RawMessage(`false`)},
+			{Path: "$.data.count", Value: json.RawMessage(`2.0`)},
+			{Path: "$.data.items[0]", Value: json.RawMessage(`{"status": "done"}`)},
+		},
+	}))
+	assert.Equal(t, "Response assertion failed: header X-Request-Id missing", check(types.ResponseAssertions{
+		Headers: map[string]string{"X-Request-Id": ""},
+	}))
+	assert.Equal(t, `Response assertion failed: header Content-Type is "application/json", expected "text/plain"`,
+		check(types.ResponseAssertions{Headers: map[string]string{"Content-Type": "text/plain"}}))
+	assert.Equal(t, "Response assertion failed: body doesn't match ^ok$", check(types.ResponseAssertions{
+		BodyRegex: "^ok$",
+	}))
+	assert.Equal(t, "Response assertion failed: field $.ok is false, expected true", check(types.ResponseAssertions{
+		Json: []types.JsonAssertion{{Path: "$.ok", Value: json.RawMessage(`true`)}},
+	}))
+	assert.Equal(t, "Response assertion failed: field $.data.items[1] missing", check(types.ResponseAssertions{
+		Json: []types.JsonAssertion{{Path: "$.data.items[1]", Value: json.RawMessage(`null`)}},
+	}))
+
+	for _, invalid := range []types.ResponseAssertions{
+		{BodyRegex: "("},
+		{Json: []types.JsonAssertion{{Path: "ok", Value: json.RawMessage(`true`)}}},
+		{Json: []types.JsonAssertion{{Path: "$.ok"}}},
+	} {
+		assert.Error(t, validateResponseAssertions(&invalid))
+	}
+}
+
+func TestRemoteRunResponseAssertions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ok": false}`))
+	}))
+	defer srv.Close()
+
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.JobType = types.RemoteJob
+	j.RemoteProperties.Url = srv.URL
+	j.RemoteProperties.ResponseAssertions.Json = []types.JsonAssertion{
+		{Path: "$.ok", Value: json.RawMessage(`true`)},
+	}
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.False(t, j.Stats[0].Success)
+	assert.Equal(t, "Response assertion failed: field $.ok is false, expected true", j.Stats[0].Error)
+}
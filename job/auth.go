@@ -0,0 +1,238 @@
+package job
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lovego/kala/types"
+)
+
+const (
+	// Headers of the "hmac" auth of remote jobs.
+	TimestampHeader = "X-Kala-Timestamp"
+	SignatureHeader = "X-Kala-Signature"
+
+	// RedactedSecret replaces the secrets of the jobs listed through the API.
+	RedactedSecret = "********"
+
+	// An OAuth2 token is fetched again this long before it expires.
+	oauth2ExpiryDelta = 10 * time.Second
+
+	maxTokenResponseSize = 1 << 20
+)
+
+// ErrRedactedSecret is returned for a job with RedactedSecret in place of a secret.
+var ErrRedactedSecret = errors.New("Invalid Job. Job's secrets can not be " + RedactedSecret)
+
+func validateRemoteAuth(a *types.RemoteAuth) error {
+	var missing string
+	switch a.Type {
+	case "":
+		return nil
+	case types.AuthBasic:
+		if a.Username == "" {
+			missing = "username"
+		}
+	case types.AuthBearer:
+		if a.Token == "" {
+			missing = "token"
+		}
+	case types.AuthOAuth2:
+		if a.TokenUrl == "" {
+			missing = "token url"
+		} else if a.ClientId == "" {
+			missing = "client id"
+		}
+	case types.AuthHmac:
+		if a.Secret == "" {
+			missing = "secret"
+		}
+	default:
+		return fmt.Errorf("Invalid auth type %s", a.Type)
+	}
+	if missing != "" {
+		return fmt.Errorf("Auth %s needs a %s", a.Type, missing)
+	}
+	return nil
+}
+
+// authorize adds the Auth of the remote job to its request with the given body.
+func (j *JobRunner) authorize(ctx context.Context, req *http.Request, body string) error {
+	a := &j.job.RemoteProperties.Auth
+	switch a.Type {
+	case types.AuthBasic:
+		creds, err := j.templatizeAuth(a.Username, a.Password)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(creds[0], creds[1])
+	case types.AuthBearer:
+		creds, err := j.templatizeAuth(a.Token)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+creds[0])
+	case types.AuthOAuth2:
+		token, err := j.oauth2Token(ctx)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	case types.AuthHmac:
+		creds, err := j.templatizeAuth(a.Secret)
+		if err != nil {
+			return err
+		}
+		timestamp := strconv.FormatInt(j.job.clk.Time().Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, "sha256="+hmacSignature(creds[0], timestamp, body))
+	}
+	return nil
+}
+
+func (j *JobRunner) templatizeAuth(values ...string) ([]string, error) {
+	for i := range values {
+		v, err := j.tryTemplatize(values[i])
+		if err != nil {
+			return nil, fmt.Errorf("Error templatizing auth: %v", err)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// hmacSignature returns the hex HMAC-SHA256 of the timestamp, a dot and the body.
+func hmacSignature(secret, timestamp, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// oauth2Token returns the job's cached OAuth2 token, or fetches a new one
+// with the client credentials grant if it has none or it has expired.
+func (j *JobRunner) oauth2Token(ctx context.Context) (string, error) {
+	j.job.authLock.Lock()
+	defer j.job.authLock.Unlock()
+
+	now := j.job.clk.Time().Now()
+	if j.job.authToken != "" && (j.job.authTokenExpiry.IsZero() || now.Before(j.job.authTokenExpiry)) {
+		return j.job.authToken, nil
+	}
+
+	a := &j.job.RemoteProperties.Auth
+	creds, err := j.templatizeAuth(a.ClientId, a.ClientSecret)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(creds[0]), url.QueryEscape(creds[1]))
+
+	client, err := j.httpClient()
+	if err != nil {
+		return "", err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		if err = j.cancelledOr(err); err == ErrJobCancelled {
+			return "", err
+		}
+		return "", fmt.Errorf("Error fetching OAuth2 token: %v", err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(io.LimitReader(res.Body, maxTokenResponseSize))
+	if err != nil {
+		if err = j.cancelledOr(err); err == ErrJobCancelled {
+			return "", err
+		}
+		return "", fmt.Errorf("Error fetching OAuth2 token: %v", err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Error fetching OAuth2 token: %s %s", res.Status, b)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(b, &token); err != nil {
+		return "", fmt.Errorf("Error fetching OAuth2 token: %v", err)
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("Error fetching OAuth2 token: no access_token in %s", b)
+	}
+
+	j.job.authToken = token.AccessToken
+	j.job.authTokenExpiry = time.Time{}
+	if token.ExpiresIn > 0 {
+		j.job.authTokenExpiry = now.Add(time.Duration(token.ExpiresIn)*time.Second - oauth2ExpiryDelta)
+	}
+	return token.AccessToken, nil
+}
+
+// forgetOAuth2Token drops the job's cached OAuth2 token, e.g. after it was refused.
+func (j *JobRunner) forgetOAuth2Token() {
+	j.job.authLock.Lock()
+	defer j.job.authLock.Unlock()
+	j.job.authToken = ""
+}
+
+// Redacted returns a copy of a job to list through the API, with the secrets of its
+// remote Auth and Transport, and the values of its headers, replaced by RedactedSecret.
+func Redacted(j *types.Job) *types.Job {
+	redacted := *j
+	auth := &redacted.RemoteProperties.Auth
+	for _, secret := range []*string{&auth.Password, &auth.Token, &auth.ClientSecret, &auth.Secret} {
+		if *secret != "" {
+			*secret = RedactedSecret
+		}
+	}
+	if headers := j.RemoteProperties.Headers; headers != nil {
+		redacted.RemoteProperties.Headers = make(http.Header, len(headers))
+		for name, values := range headers {
+			masked := make([]string, len(values))
+			for i := range masked {
+				masked[i] = RedactedSecret
+			}
+			redacted.RemoteProperties.Headers[name] = masked
+		}
+	}
+	redacted.RemoteProperties.Transport = RedactedTransport(j.RemoteProperties.Transport)
+	return &redacted
+}
+
+// hasRedactedSecret reports whether a job has RedactedSecret in place of a secret, e.g. because
+// it was copied from a job listed through the API, so it would run with the placeholder.
+func hasRedactedSecret(j *types.Job) bool {
+	auth := j.RemoteProperties.Auth
+	for _, secret := range []string{auth.Password, auth.Token, auth.ClientSecret, auth.Secret} {
+		if secret == RedactedSecret {
+			return true
+		}
+	}
+	for _, values := range j.RemoteProperties.Headers {
+		for _, value := range values {
+			if value == RedactedSecret {
+				return true
+			}
+		}
+	}
+	return j.RemoteProperties.Transport != nil && j.RemoteProperties.Transport.ClientKey == RedactedSecret
+}
@@ -0,0 +1,114 @@
+package job
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteAuth(t *testing.T) {
+	var req *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := new(strings.Builder)
+		_, _ = io.Copy(b, r.Body)
+		req, body = r, b.String()
+	}))
+	defer srv.Close()
+	run := func(auth types.RemoteAuth) {
+		j := GetMockRemoteJob(types.RemoteProperties{Url: srv.URL, Body: `{"a": 1}`, Auth: auth})
+		assert.NoError(t, validateRemoteAuth(&auth))
+		_, err := (&JobRunner{job: j}).RemoteRun()
+		assert.NoError(t, err)
+	}
+
+	run(types.RemoteAuth{Type: types.AuthBasic, Username: "kala", Password: "pass"})
+	username, password, ok := req.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "kala", username)
+	assert.Equal(t, "pass", password)
+
+	run(types.RemoteAuth{Type: types.AuthBearer, Token: "token"})
+	assert.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+	run(types.RemoteAuth{Type: types.AuthHmac, Secret: "secret"})
+	timestamp := req.Header.Get(TimestampHeader)
+	assert.NotEmpty(t, timestamp)
+	assert.Equal(t, `{"a": 1}`, body)
+	assert.Equal(t, "sha256="+hmacSignature("secret", timestamp, body), req.Header.Get(SignatureHeader))
+
+	for _, invalid := range []types.RemoteAuth{
+		{Type: "digest"},
+		{Type: types.AuthBasic},
+		{Type: types.AuthBearer},
+		{Type: types.AuthOAuth2, TokenUrl: srv.URL},
+		{Type: types.AuthHmac},
+	} {
+		assert.Error(t, validateRemoteAuth(&invalid), invalid.Type)
+	}
+}
+
+func TestRemoteAuthOAuth2(t *testing.T) {
+	tokens := 0
+	tokenSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		assert.Equal(t, "client", id)
+		assert.Equal(t, "secret", secret)
+		assert.NoError(t, r.ParseForm())
+		assert.Equal(t, "client_credentials", r.Form.Get("grant_type"))
+		assert.Equal(t, "read write", r.Form.Get("scope"))
+		tokens++
+		w.Write([]byte(fmt.Sprintf(`{"access_token": "token%d", "expires_in": 3600}`, tokens)))
+	}))
+	defer tokenSrv.Close()
+	var authorizations []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		if len(authorizations) == 2 {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer srv.Close()
+
+	j := GetMockRemoteJob(types.RemoteProperties{Url: srv.URL, Auth: types.RemoteAuth{
+		Type: types.AuthOAuth2, TokenUrl: tokenSrv.URL, ClientId: "client", ClientSecret: "secret",
+		Scopes: []string{"read", "write"},
+	}})
+	r := &JobRunner{job: j}
+	for i := 0; i < 3; i++ {
+		_, _ = r.RemoteRun()
+	}
+	assert.Equal(t, 2, tokens)
+	assert.Equal(t, []string{"Bearer token1", "Bearer token1", "Bearer token2"}, authorizations)
+}
+
+func TestRedacted(t *testing.T) {
+	j := GetMockRemoteJob(types.RemoteProperties{
+		Url:     "http://example.com",
+		Headers: http.Header{"Authorization": {"Basic a2FsYQ=="}, "Accept": {"*/*"}},
+		Auth:    types.RemoteAuth{Type: types.AuthBasic, Username: "kala", Password: "pass"},
+	})
+	redacted := Redacted(j.Job)
+	assert.Equal(t, "kala", redacted.RemoteProperties.Auth.Username)
+	assert.Equal(t, RedactedSecret, redacted.RemoteProperties.Auth.Password)
+	assert.Equal(t, "", redacted.RemoteProperties.Auth.Token)
+	assert.Equal(t, RedactedSecret, redacted.RemoteProperties.Headers.Get("Authorization"))
+	assert.Equal(t, RedactedSecret, redacted.RemoteProperties.Headers.Get("Accept"))
+
+	assert.Equal(t, "pass", j.RemoteProperties.Auth.Password)
+	assert.Equal(t, "Basic a2FsYQ==", j.RemoteProperties.Headers.Get("Authorization"))
+
+	// A copy of the redacted job would run with the placeholders.
+	copied := &Job{Job: redacted}
+	assert.Equal(t, ErrRedactedSecret, copied.validation())
+	redacted.RemoteProperties.Auth.Password = "pass"
+	assert.Equal(t, ErrRedactedSecret, copied.validation())
+	redacted.RemoteProperties.Headers = nil
+	assert.NoError(t, copied.validation())
+}
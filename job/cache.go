@@ -67,8 +67,11 @@ func (c *MemoryJobCache) Start(persistWaitTime time.Duration) {
 		Logger.Fatal(err)
 	}
 	for _, j := range allJobs {
+		j.applyMisfirePolicy()
 		if j.ShouldStartWaiting() {
 			j.StartWaiting(c, false)
+		} else if !j.Disabled {
+			j.IsDone = true
 		}
 		err = c.Set(j)
 		if err != nil {
@@ -153,6 +156,9 @@ func (c *MemoryJobCache) Delete(id string, logical bool) error {
 			return err
 		}
 	}
+	deleteJobRunLogs(id)
+	forgetHttpClient(id)
+	forgetOccurrence(j.GroupName, id)
 
 	j.lock.Unlock()
 	j.StopTimer()
@@ -238,18 +244,21 @@ func (c *LockFreeJobCache) Start(redisPool *redis.Pool, persistWaitTime time.Dur
 	if err != nil {
 		Logger.Fatal(err)
 	}
-	// Clear all jobs running stat
-	err = clear(allJobs...)
+	// Reclaim the leases of the jobs left running by crashed nodes
+	err = reclaimExpired(allJobs...)
 	if err != nil {
 		Logger.Fatal(err)
 	}
 	for _, j := range allJobs {
-		if j.Schedule == "" {
+		if !j.hasSchedule() {
 			Logger.Infof("Job %s:%s skipped.", j.Name, j.Id)
 			continue
 		}
+		j.applyMisfirePolicy()
 		if j.ShouldStartWaiting() {
 			j.StartWaiting(c, false)
+		} else if !j.Disabled {
+			j.IsDone = true
 		}
 		// Logger.Infof("Job %s:%s added to cache.", j.Name, j.Id)
 		err := c.Set(j)
@@ -257,6 +266,8 @@ func (c *LockFreeJobCache) Start(redisPool *redis.Pool, persistWaitTime time.Dur
 			Logger.Error(err)
 		}
 	}
+	startReceivingCancels(c)
+
 	// Occasionally, save items in cache to db.
 	if persistWaitTime > 0 {
 		go c.PersistEvery(persistWaitTime)
@@ -331,6 +342,9 @@ func (c *LockFreeJobCache) Delete(id string, logical bool) error {
 		err = c.Set(j)
 	} else {
 		err = c.jobDB.Delete(id)
+		deleteJobRunLogs(id)
+		forgetHttpClient(id)
+		forgetOccurrence(j.GroupName, id)
 	}
 	if err != nil {
 		err = fmt.Errorf("Error occurred while trying to delete job from db: %s", err)
@@ -421,6 +435,7 @@ func (c *LockFreeJobCache) compactJobStats(job *Job) {
 	pos := c.locateJobStatsIndexForRetention(job.Stats)
 	if pos >= 0 {
 		Logger.Infof("JobStats TTL: removing %d items", pos+1)
+		deleteRunLogs(job.Id, job.Stats[:pos+1])
 		tmp := make([]*types.JobStat, len(job.Stats)-pos-1)
 		copy(tmp, job.Stats[pos+1:])
 		job.Stats = tmp
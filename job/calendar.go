@@ -0,0 +1,306 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/ics"
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+var (
+	// Redis hash of the blackout calendars, shared by all nodes.
+	calendarsKey = "kala-calendars"
+
+	ErrCalendarDoesntExist = errors.New("The calendar you requested does not exist")
+	ErrInvalidCalendar     = errors.New("Invalid Calendar. Calendar's must contain a Name")
+)
+
+// How many times a run is deferred to the end of a blackout window
+// before giving up, e.g. for overlapping windows covering the whole week.
+const maxDeferrals = 100
+
+// SetCalendar creates or replaces a blackout calendar.
+func SetCalendar(c *types.Calendar) error {
+	if err := validateCalendar(c); err != nil {
+		return err
+	}
+	return hashSet(calendarsKey, c.Name, c)
+}
+
+// GetCalendar returns a blackout calendar.
+func GetCalendar(name string) (*types.Calendar, error) {
+	c := &types.Calendar{}
+	if ok, err := hashGet(calendarsKey, name, c); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrCalendarDoesntExist
+	}
+	return c, nil
+}
+
+// GetAllCalendars returns all blackout calendars by name.
+func GetAllCalendars() (map[string]*types.Calendar, error) {
+	values, err := hashGetAll(calendarsKey)
+	if err != nil {
+		return nil, err
+	}
+	calendars := make(map[string]*types.Calendar, len(values))
+	for name, value := range values {
+		c := &types.Calendar{}
+		if err := json.Unmarshal(value, c); err != nil {
+			return nil, err
+		}
+		calendars[name] = c
+	}
+	return calendars, nil
+}
+
+// DeleteCalendar deletes a blackout calendar.
+func DeleteCalendar(name string) error {
+	return hashDelete(calendarsKey, name)
+}
+
+// ImportCalendar replaces the date ranges of a blackout calendar with the events
+// of an iCalendar file, creating the calendar if it doesn't exist.
+// Dates and floating datetimes of the file are in the calendar's time zone.
+func ImportCalendar(name string, r io.Reader) (*types.Calendar, error) {
+	c, err := GetCalendar(name)
+	if err == ErrCalendarDoesntExist {
+		c = &types.Calendar{Name: name}
+	} else if err != nil {
+		return nil, err
+	}
+	loc, err := calendarLocation(c)
+	if err != nil {
+		return nil, err
+	}
+	events, skipped, err := ics.Parse(r, loc)
+	if err != nil {
+		return nil, err
+	}
+	for _, err := range skipped {
+		Logger.Errorf("Calendar %s left out %s", name, err)
+	}
+	c.Ranges = make([]types.DateRange, 0, len(events))
+	for _, event := range events {
+		c.Ranges = append(c.Ranges, types.DateRange{Start: event.Start, End: event.End, Summary: event.Summary})
+	}
+	return c, SetCalendar(c)
+}
+
+func validateCalendar(c *types.Calendar) error {
+	if c.Name == "" {
+		return ErrInvalidCalendar
+	}
+	if _, err := calendarLocation(c); err != nil {
+		return err
+	}
+	for _, r := range c.Ranges {
+		if !r.End.After(r.Start) {
+			return fmt.Errorf("Invalid Calendar. Range %s %s doesn't end after it starts", r.Summary, r.Start)
+		}
+	}
+	for _, w := range c.Weekly {
+		for _, day := range w.Days {
+			if day < time.Sunday || day > time.Saturday {
+				return fmt.Errorf("Invalid Calendar. Weekday %d should be from 0 (Sunday) to 6 (Saturday)", day)
+			}
+		}
+		if _, err := parseTimeOfDay(w.Start); err != nil {
+			return err
+		}
+		if _, err := parseTimeOfDay(w.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func calendarLocation(c *types.Calendar) (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(c.TimeZone)
+}
+
+// parseTimeOfDay parses "15:04" into minutes after midnight, "24:00" included.
+func parseTimeOfDay(s string) (int, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) == 2 { //nolint:gomnd
+		hour, errHour := strconv.Atoi(parts[0])
+		minute, errMinute := strconv.Atoi(parts[1])
+		if errHour == nil && errMinute == nil && hour >= 0 && minute >= 0 && minute < 60 &&
+			(hour < 24 || hour == 24 && minute == 0) {
+			return hour*60 + minute, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid Calendar. Time of day %q should look like 15:04", s)
+}
+
+// calendarWindow returns the end of the blackout windows of c that t is in, if any.
+// If t is in several windows, the latest end is returned.
+func calendarWindow(c *types.Calendar, t time.Time) (time.Time, bool) {
+	var windowsEnd time.Time
+	inWindow := func(start, end time.Time) {
+		if !t.Before(start) && t.Before(end) && end.After(windowsEnd) {
+			windowsEnd = end
+		}
+	}
+	for _, r := range c.Ranges {
+		inWindow(r.Start, r.End)
+	}
+	if len(c.Weekly) == 0 {
+		return windowsEnd, !windowsEnd.IsZero()
+	}
+
+	loc, err := calendarLocation(c)
+	if err != nil {
+		loc = time.Local
+	}
+	local := t.In(loc)
+	for _, w := range c.Weekly {
+		start, _ := parseTimeOfDay(w.Start)
+		end, _ := parseTimeOfDay(w.End)
+		endDays := 0
+		if end <= start {
+			endDays = 1
+		}
+		// A window started today, or yesterday and ending today.
+		for _, days := range []int{0, -1} {
+			day := local.AddDate(0, 0, days)
+			if !hasWeekday(w.Days, day.Weekday()) {
+				continue
+			}
+			inWindow(
+				iso8601.Date(day.Year(), day.Month(), day.Day(), 0, start, 0, 0, loc),
+				iso8601.Date(day.Year(), day.Month(), day.Day()+endDays, 0, end, 0, 0, loc),
+			)
+		}
+	}
+	return windowsEnd, !windowsEnd.IsZero()
+}
+
+func hasWeekday(days []time.Weekday, weekday time.Weekday) bool {
+	for _, day := range days {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+// blackoutCalendars returns the calendars of the job and of its group.
+func (j *Job) blackoutCalendars(group *types.Group) ([]*types.Calendar, error) {
+	if pool == nil {
+		return nil, nil
+	}
+	j.lock.RLock()
+	names := append([]string{}, j.Calendars...)
+	j.lock.RUnlock()
+
+	if group != nil {
+		names = append(names, group.Calendars...)
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	args := redis.Args{}.Add(calendarsKey).AddFlat(names)
+	conn := pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("HMGET", args...))
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]*types.Calendar, 0, len(values))
+	for i, value := range values {
+		if value == nil {
+			Logger.Errorf("Job %s:%s calendar %s doesn't exist.", j.Name, j.Id, names[i])
+			continue
+		}
+		c := &types.Calendar{}
+		if err := json.Unmarshal(value, c); err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, c)
+	}
+	return calendars, nil
+}
+
+// applyCalendars returns the wait duration before the next run, deferred past the
+// blackout windows of the job's calendars, or the reason to skip the next run
+// if it falls inside a window of a calendar that doesn't defer runs.
+func (j *Job) applyCalendars(waitDuration time.Duration, group *types.Group) (time.Duration, string) {
+	calendars, err := j.blackoutCalendars(group)
+	if err != nil {
+		Logger.Errorf("Job %s:%s error getting its calendars: %s", j.Name, j.Id, err)
+		return waitDuration, ""
+	}
+	if len(calendars) == 0 {
+		return waitDuration, ""
+	}
+
+	now := j.clk.Time().Now()
+	runAt := now
+	if waitDuration > 0 {
+		runAt = now.Add(waitDuration)
+	}
+	deferred := false
+	for i := 0; i < maxDeferrals; i++ {
+		var deferTo time.Time
+		for _, c := range calendars {
+			end, ok := calendarWindow(c, runAt)
+			if !ok {
+				continue
+			}
+			if !c.Defer {
+				return waitDuration, "blackout calendar " + c.Name
+			}
+			if end.After(deferTo) {
+				deferTo = end
+			}
+		}
+		if deferTo.IsZero() {
+			break
+		}
+		runAt, deferred = deferTo, true
+	}
+	if !deferred {
+		return waitDuration, ""
+	}
+	Logger.Infof("Job %s:%s deferred to %s by its calendars.", j.Name, j.Id, runAt)
+	return runAt.Sub(now), ""
+}
+
+// skipRun records the run at skippedAt, scheduled at scheduledAt, as skipped
+// because of a blackout calendar, and waits for the next one.
+func (j *Job) skipRun(cache JobCache, skippedAt, scheduledAt time.Time, reason string) {
+	if _, err := cache.Get(j.Id); errors.Is(err, ErrJobDoesntExist) {
+		return
+	}
+	j.lock.RLock()
+	disabled := j.Disabled
+	meta := j.Metadata
+	j.lock.RUnlock()
+	if disabled {
+		return
+	}
+
+	Logger.Infof("Job %s:%s skipped by %s.", j.Name, j.Id, reason)
+	// The next run is computed from the skipped one, as if it ran on time.
+	meta.LastAttemptedRun = skippedAt
+	meta.LastScheduledRun = scheduledAt
+	stat := NewJobStat(j.Id)
+	stat.RanAt = skippedAt
+	stat.Skipped = true
+	stat.SkipReason = reason
+	j.finishRun(cache, meta, stat)
+}
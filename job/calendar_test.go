@@ -0,0 +1,161 @@
+package job
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarWindow(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2021, time.March, day, hour, min, 0, 0, loc)
+	}
+
+	c := &types.Calendar{
+		Name:     "test",
+		TimeZone: "Europe/Berlin",
+		Ranges:   []types.DateRange{{Start: at(1, 0, 0), End: at(3, 0, 0)}},
+		Weekly: []types.WeeklyWindow{
+			{Days: []time.Weekday{time.Saturday, time.Sunday}, Start: "00:00", End: "24:00"},
+			{Days: []time.Weekday{time.Friday}, Start: "22:00", End: "06:00"},
+		},
+	}
+	assert.NoError(t, validateCalendar(c))
+
+	for _, w := range []struct {
+		t   time.Time
+		end time.Time
+	}{
+		{at(1, 0, 0), at(3, 0, 0)},
+		{at(2, 23, 59), at(3, 0, 0)},
+		{at(3, 0, 0), time.Time{}},
+		{at(5, 21, 59), time.Time{}}, // Friday
+		{at(5, 22, 0), at(6, 6, 0)},
+		{at(6, 5, 59), at(7, 0, 0)}, // and Saturday
+		{at(6, 6, 0), at(7, 0, 0)},  // Saturday
+		{at(7, 12, 0), at(8, 0, 0)},
+		{at(8, 0, 0), time.Time{}}, // Monday
+		// Clocks jumped from 02:00 to 03:00 on Sunday 2021-03-28.
+		{at(28, 1, 0), at(29, 0, 0)},
+	} {
+		end, ok := calendarWindow(c, w.t)
+		assert.Equal(t, !w.end.IsZero(), ok, w.t.String())
+		assert.Equal(t, w.end, end, w.t.String())
+	}
+
+	for _, invalid := range []*types.Calendar{
+		{},
+		{Name: "test", TimeZone: "Mars/Olympus_Mons"},
+		{Name: "test", Ranges: []types.DateRange{{Start: at(3, 0, 0), End: at(1, 0, 0)}}},
+		{Name: "test", Weekly: []types.WeeklyWindow{{Days: []time.Weekday{7}, Start: "00:00", End: "24:00"}}},
+		{Name: "test", Weekly: []types.WeeklyWindow{{Start: "24:01", End: "01:00"}}},
+		{Name: "test", Weekly: []types.WeeklyWindow{{Start: "8am", End: "9am"}}},
+	} {
+		assert.Error(t, validateCalendar(invalid))
+	}
+}
+
+func TestCalendarSkip(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC) // Monday
+	clk := clock.NewMockClock(now)
+	cache := NewMockCache()
+
+	assert.NoError(t, SetCalendar(&types.Calendar{
+		Name:   "test-freeze",
+		Ranges: []types.DateRange{{Start: now, End: now.Add(time.Minute)}},
+	}))
+	defer DeleteCalendar("test-freeze")
+
+	j := GetMockJobWithSchedule(1, now.Add(5*time.Second), "PT1H")
+	j.Calendars = []string{"test-freeze"}
+	j.clk.SetClock(clk)
+	j.succeedInstantly = true
+	j.ranChan = make(chan struct{})
+	assert.NoError(t, j.Init(cache))
+
+	clk.AddTime(6 * time.Second)
+	awaitJobRan(t, j, 5*time.Second)
+	j.lock.RLock()
+	assert.Len(t, j.Stats, 1)
+	assert.True(t, j.Stats[0].Skipped)
+	assert.Equal(t, "blackout calendar test-freeze", j.Stats[0].SkipReason)
+	assert.Equal(t, uint(0), j.Metadata.SuccessCount)
+	assert.Equal(t, now.Add(time.Hour+5*time.Second), j.NextRunAt)
+	j.lock.RUnlock()
+
+	clk.AddTime(time.Hour)
+	awaitJobRan(t, j, 5*time.Second)
+	// The skipped run doesn't count as one of the job's repetitions.
+	j.lock.RLock()
+	assert.Len(t, j.Stats, 2)
+	assert.Equal(t, uint(1), j.Metadata.SuccessCount)
+	assert.False(t, j.IsDone)
+	j.lock.RUnlock()
+
+	clk.AddTime(time.Hour)
+	awaitJobRan(t, j, 5*time.Second)
+	j.lock.RLock()
+	assert.Len(t, j.Stats, 3)
+	assert.Equal(t, uint(2), j.Metadata.SuccessCount)
+	assert.True(t, j.IsDone)
+	j.lock.RUnlock()
+}
+
+func TestCalendarDefer(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC) // Monday
+	clk := clock.NewMockClock(now)
+	cache := NewMockCache()
+
+	assert.NoError(t, SetCalendar(&types.Calendar{
+		Name:     "test-standup",
+		TimeZone: "UTC",
+		Weekly:   []types.WeeklyWindow{{Days: []time.Weekday{time.Monday}, Start: "10:00", End: "11:00"}},
+		Defer:    true,
+	}))
+	defer DeleteCalendar("test-standup")
+	assert.NoError(t, SetGroup(&types.Group{Name: "test-calendar-group", Calendars: []string{"test-standup"}}))
+	defer DeleteGroup("test-calendar-group")
+
+	j := GetMockJobWithSchedule(2, now.Add(5*time.Second), "PT1H")
+	j.GroupName = "test-calendar-group"
+	j.clk.SetClock(clk)
+	j.succeedInstantly = true
+	j.ranChan = make(chan struct{})
+	assert.NoError(t, j.Init(cache))
+
+	j.lock.RLock()
+	assert.Equal(t, time.Date(2021, time.January, 4, 11, 0, 0, 0, time.UTC), j.NextRunAt)
+	j.lock.RUnlock()
+
+	clk.AddTime(time.Hour)
+	awaitJobRan(t, j, 5*time.Second)
+	// The next run follows the schedule, not the deferred run.
+	j.lock.RLock()
+	assert.Equal(t, uint(1), j.Metadata.SuccessCount)
+	assert.Equal(t, time.Date(2021, time.January, 4, 11, 0, 5, 0, time.UTC), j.NextRunAt)
+	j.lock.RUnlock()
+}
+
+func TestImportCalendar(t *testing.T) {
+	c, err := ImportCalendar("test-holidays", strings.NewReader(
+		"BEGIN:VCALENDAR\nBEGIN:VEVENT\nDTSTART;VALUE=DATE:20211225\nSUMMARY:Christmas Day\nEND:VEVENT\n"+
+			// An event with an unsupported rule is left out.
+			"BEGIN:VEVENT\nDTSTART:20211225T100000Z\nDURATION:PT1H\nRRULE:FREQ=HOURLY\nEND:VEVENT\nEND:VCALENDAR\n",
+	))
+	assert.NoError(t, err)
+	defer DeleteCalendar("test-holidays")
+	assert.Len(t, c.Ranges, 1)
+
+	c, err = GetCalendar("test-holidays")
+	assert.NoError(t, err)
+	assert.Equal(t, "Christmas Day", c.Ranges[0].Summary)
+
+	_, err = GetCalendar("test-no-such-calendar")
+	assert.Equal(t, ErrCalendarDoesntExist, err)
+}
@@ -0,0 +1,143 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+)
+
+var (
+	// Redis channel of the ids of the jobs to cancel, followed by a space and the id
+	// of the node cancelling them, subscribed by all nodes.
+	cancelChannel = "kala-job-cancel"
+
+	ErrJobNotRunning = errors.New("Job is not running")
+
+	receiveCancelsOnce sync.Once
+)
+
+// How often the connection receiving the cancelled jobs is checked.
+const cancelPingPeriod = time.Minute
+
+// Cancel aborts the running attempts of the job, on whichever nodes run them.
+// The run is recorded as cancelled, without retrying it nor running the OnFailureJob.
+// Each node releases the lease of its run once the run is aborted,
+// so the job counts as running until then.
+func (j *Job) Cancel() error {
+	if !j.cancelLocal() {
+		running, err := j.isRunning()
+		if err != nil {
+			return err
+		}
+		if !running {
+			return ErrJobNotRunning
+		}
+	}
+	// Other nodes may run the job too, up to its MaxParallel.
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("PUBLISH", cancelChannel, j.Id+" "+NodeId)
+	return err
+}
+
+// cancellableRun returns the context of a run, cancelled by cancelLocal
+// until the returned function is called at the end of the run.
+func (j *Job) cancellableRun() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.runLock.Lock()
+	if j.cancelRuns == nil {
+		j.cancelRuns = map[int]context.CancelFunc{}
+	}
+	j.runSeq++
+	seq := j.runSeq
+	j.cancelRuns[seq] = cancel
+	j.runLock.Unlock()
+
+	return ctx, func() {
+		j.runLock.Lock()
+		delete(j.cancelRuns, seq)
+		j.runLock.Unlock()
+		cancel()
+	}
+}
+
+// cancelLocal cancels the runs of the job on this node, if any.
+func (j *Job) cancelLocal() bool {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	if len(j.cancelRuns) == 0 {
+		return false
+	}
+	for _, cancel := range j.cancelRuns {
+		cancel()
+	}
+	Logger.Infof("Job %s:%s cancelled.", j.Name, j.Id)
+	return true
+}
+
+// startReceivingCancels starts receiveCancels, once per process.
+func startReceivingCancels(cache JobCache) {
+	receiveCancelsOnce.Do(func() {
+		go receiveCancels(cache)
+	})
+}
+
+// receiveCancels cancels the runs on this node of the jobs cancelled on other nodes.
+func receiveCancels(cache JobCache) {
+	for {
+		if err := subscribeCancels(cache); err != nil {
+			Logger.Errorf("Error receiving cancelled jobs: %s", err)
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func subscribeCancels(cache JobCache) error {
+	// The runs of this node are cancelled by Cancel itself, the later ones are kept.
+	self := NodeId
+	conn := redis.PubSubConn{Conn: pool.Get()}
+	defer conn.Close()
+	if err := conn.Subscribe(cancelChannel); err != nil {
+		return err
+	}
+
+	// Pings keep the connection from timing out, and detect broken ones.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(cancelPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := conn.Ping(""); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		switch v := conn.ReceiveWithTimeout(2 * cancelPingPeriod).(type) {
+		case redis.Message:
+			id, node := string(v.Data), ""
+			if i := strings.IndexByte(id, ' '); i >= 0 {
+				id, node = id[:i], id[i+1:]
+			}
+			if node == self {
+				continue
+			}
+			if j, err := cache.Get(id); err == nil {
+				j.cancelLocal()
+			}
+		case error:
+			return v
+		}
+	}
+}
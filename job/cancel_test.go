@@ -0,0 +1,108 @@
+package job
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// runUntilCancelled runs j in the background, cancels it with cancel once it runs,
+// and returns the stat of the run.
+func runUntilCancelled(t *testing.T, cache JobCache, j *Job, cancel func() error) *types.JobStat {
+	done := make(chan struct{})
+	go func() {
+		j.Run(cache)
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		running, err := j.isRunning()
+		assert.NoError(t, err)
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Job didn't start")
+		}
+	}
+	assert.NoError(t, cancel())
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Job wasn't cancelled")
+	}
+	running, err := j.isRunning()
+	assert.NoError(t, err)
+	assert.False(t, running)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 1)
+	assert.Equal(t, uint(0), j.Metadata.ErrorCount)
+	assert.Equal(t, uint(1), j.Metadata.NumberOfFinishedRuns)
+	return j.Stats[0]
+}
+
+func TestCancelLocalJob(t *testing.T) {
+	cache := NewMockCache()
+	onFailure := GetMockJobWithGenericSchedule(time.Now())
+	assert.NoError(t, onFailure.Init(cache))
+
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = "sleep 10"
+	j.OnFailureJob = onFailure.Id
+	assert.NoError(t, j.Init(cache))
+	assert.Equal(t, ErrJobNotRunning, j.Cancel())
+
+	stat := runUntilCancelled(t, cache, j, j.Cancel)
+	assert.True(t, stat.Cancelled)
+	assert.False(t, stat.Success)
+	assert.Equal(t, uint(0), stat.NumberOfRetries)
+	assert.Equal(t, ErrJobCancelled.Error(), stat.Error)
+
+	onFailure.lock.RLock()
+	assert.Empty(t, onFailure.Stats)
+	onFailure.lock.RUnlock()
+}
+
+func TestCancelRemoteJob(t *testing.T) {
+	requested := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(requested)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cache := NewMockCache()
+	j := GetMockRemoteJob(types.RemoteProperties{Url: srv.URL, Timeout: 10})
+	j.Schedule = GetMockJobWithGenericSchedule(time.Now()).Schedule
+	assert.NoError(t, j.Init(cache))
+
+	stat := runUntilCancelled(t, cache, j, func() error {
+		<-requested
+		return j.Cancel()
+	})
+	assert.True(t, stat.Cancelled)
+}
+
+func TestCancelOnOtherNode(t *testing.T) {
+	cache := NewMockCache()
+	go receiveCancels(cache)
+
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = "sleep 10"
+	assert.NoError(t, j.Init(cache))
+
+	// The same job, loaded by another node.
+	other := &Job{Job: &types.Job{Id: j.Id, Name: j.Name, GroupName: j.GroupName}}
+	stat := runUntilCancelled(t, cache, j, func() error {
+		defer func(id string) { NodeId = id }(NodeId)
+		NodeId = "other node"
+		return other.Cancel()
+	})
+	assert.True(t, stat.Cancelled)
+}
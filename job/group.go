@@ -0,0 +1,136 @@
+package job
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+var (
+	// Redis hash of the group settings, shared by all nodes.
+	groupsKey = "kala-groups"
+
+	ErrGroupDoesntExist = errors.New("The group you requested does not exist")
+	ErrInvalidGroup     = errors.New("Invalid Group. Group's must contain a Name")
+)
+
+// SetGroup creates or replaces the settings of a group.
+func SetGroup(g *types.Group) error {
+	if g.Name == "" {
+		return ErrInvalidGroup
+	}
+	if g.Jitter != "" {
+		if _, err := iso8601.FromString(g.Jitter); err != nil {
+			return err
+		}
+	}
+	if err := validateQueueOrder(g.QueueOrder); err != nil {
+		return err
+	}
+	return hashSet(groupsKey, g.Name, g)
+}
+
+// GetGroup returns the settings of a group.
+func GetGroup(name string) (*types.Group, error) {
+	g := &types.Group{}
+	if ok, err := hashGet(groupsKey, name, g); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrGroupDoesntExist
+	}
+	return g, nil
+}
+
+// GetAllGroups returns the settings of all groups by name.
+func GetAllGroups() (map[string]*types.Group, error) {
+	values, err := hashGetAll(groupsKey)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*types.Group, len(values))
+	for name, value := range values {
+		g := &types.Group{}
+		if err := json.Unmarshal(value, g); err != nil {
+			return nil, err
+		}
+		groups[name] = g
+	}
+	return groups, nil
+}
+
+// DeleteGroup deletes the settings of a group, the jobs of the group are kept.
+func DeleteGroup(name string) error {
+	return hashDelete(groupsKey, name)
+}
+
+// getGroup returns the settings of a group, or nil if it has none.
+func getGroup(name string) (*types.Group, error) {
+	if name == "" || pool == nil {
+		return nil, nil
+	}
+	g, err := GetGroup(name)
+	if err == ErrGroupDoesntExist {
+		return nil, nil
+	}
+	return g, err
+}
+
+// group returns the settings of the job's group, or nil if it has none.
+func (j *Job) group() *types.Group {
+	j.lock.RLock()
+	name := j.GroupName
+	j.lock.RUnlock()
+
+	g, err := getGroup(name)
+	if err != nil {
+		Logger.Errorf("Job %s:%s error getting its group %s: %s", j.Name, j.Id, name, err)
+	}
+	return g
+}
+
+func hashSet(key, field string, value interface{}) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	conn := pool.Get()
+	defer conn.Close()
+	_, err = conn.Do("HSET", key, field, b)
+	return err
+}
+
+func hashGet(key, field string, value interface{}) (bool, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	b, err := redis.Bytes(conn.Do("HGET", key, field))
+	if err == redis.ErrNil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(b, value)
+}
+
+func hashGetAll(key string) (map[string][]byte, error) {
+	conn := pool.Get()
+	defer conn.Close()
+	values, err := redis.ByteSlices(conn.Do("HGETALL", key))
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string][]byte, len(values)/2) //nolint:gomnd
+	for i := 0; i+1 < len(values); i += 2 {
+		m[string(values[i])] = values[i+1]
+	}
+	return m, nil
+}
+
+func hashDelete(key, field string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("HDEL", key, field)
+	return err
+}
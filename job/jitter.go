@@ -0,0 +1,43 @@
+package job
+
+import (
+	"hash/fnv"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+// updateJitter sets and returns the delay of the job's runs within its Jitter,
+// or within the default Jitter of its group.
+// The delay is derived from the job's Id, so it doesn't change between runs.
+func (j *Job) updateJitter(group *types.Group) time.Duration {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	jitter := j.jitterDuration
+	if jitter == nil && group != nil && group.Jitter != "" {
+		var err error
+		if jitter, err = iso8601.FromString(group.Jitter); err != nil {
+			Logger.Errorf("Error converting group %s Jitter to iso8601.Duration: %s", group.Name, err)
+		}
+	}
+	j.jitter = 0
+	if jitter != nil {
+		if d := jitter.RelativeTo(j.clk.Time().Now()); d > 0 {
+			h := fnv.New64a()
+			_, _ = h.Write([]byte(j.Id))
+			j.jitter = time.Duration(h.Sum64() % uint64(d))
+		}
+	}
+	return j.jitter
+}
+
+// lastScheduledRun returns the scheduled run point of the last run,
+// without its jitter or the deferral by its calendars.
+func (j *Job) lastScheduledRun() time.Time {
+	if !j.Metadata.LastScheduledRun.IsZero() {
+		return j.Metadata.LastScheduledRun
+	}
+	return j.Metadata.LastAttemptedRun.Add(-j.jitter)
+}
@@ -0,0 +1,70 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJitterIsDeterministic(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	offset := func(id string) time.Duration {
+		j := &Job{Job: &types.Job{Id: id, Schedule: "R/2021-01-04T10:00:00Z/PT1H", Jitter: "PT10M"}}
+		j.clk.SetClock(clock.NewMockClock(now))
+		assert.NoError(t, j.InitDelayDuration(false))
+		return j.updateJitter(nil)
+	}
+
+	first := offset("job-1")
+	assert.True(t, first >= 0 && first < 10*time.Minute, first.String())
+	assert.Equal(t, first, offset("job-1"))
+	assert.NotEqual(t, first, offset("job-2"))
+}
+
+func TestJitterDelaysRuns(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewMockClock(now)
+	cache := NewMockCache()
+
+	j := GetMockJobWithSchedule(2, now.Add(5*time.Second), "PT1H")
+	j.Jitter = "PT10M"
+	j.clk.SetClock(clk)
+	j.succeedInstantly = true
+	j.ranChan = make(chan struct{})
+	assert.NoError(t, j.Init(cache))
+
+	j.lock.RLock()
+	jitter := j.jitter
+	assert.True(t, jitter > 0 && jitter < 10*time.Minute, jitter.String())
+	assert.Equal(t, now.Add(5*time.Second+jitter), j.NextRunAt)
+	j.lock.RUnlock()
+
+	clk.AddTime(5*time.Second + jitter)
+	awaitJobRan(t, j, 5*time.Second)
+	// The next run is an interval after the scheduled one, delayed by the same jitter.
+	j.lock.RLock()
+	assert.Equal(t, now.Add(time.Hour+5*time.Second+jitter), j.NextRunAt)
+	j.lock.RUnlock()
+}
+
+func TestGroupJitter(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	cache := NewMockCache()
+
+	assert.NoError(t, SetGroup(&types.Group{Name: "test-jitter-group", Jitter: "PT10M"}))
+	defer DeleteGroup("test-jitter-group")
+	assert.Error(t, SetGroup(&types.Group{Name: "test-jitter-group", Jitter: "10 minutes"}))
+
+	j := GetMockJobWithSchedule(0, now.Add(5*time.Second), "PT1H")
+	j.GroupName = "test-jitter-group"
+	j.clk.SetClock(clock.NewMockClock(now))
+	assert.NoError(t, j.Init(cache))
+
+	j.lock.RLock()
+	assert.True(t, j.jitter > 0 && j.jitter < 10*time.Minute, j.jitter.String())
+	assert.Equal(t, now.Add(5*time.Second+j.jitter), j.NextRunAt)
+	j.lock.RUnlock()
+}
@@ -2,6 +2,7 @@ package job
 
 import (
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"time"
 
 	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/cron"
 	"github.com/lovego/kala/utils/iso8601"
 	"github.com/lovego/logger"
 	"github.com/mixer/clock"
@@ -26,6 +28,8 @@ var (
 	ErrInvalidJob       = errors.New("Invalid Local Job. Job's must contain a Name and a Command field")
 	ErrInvalidRemoteJob = errors.New("Invalid Remote Job. Job's must contain a Name and a url field")
 	ErrInvalidJobType   = errors.New("Invalid Job type. Types supported: 0 for local and 1 for remote")
+	ErrScheduleAndCron  = errors.New("Invalid Job. Job's can not have both a Schedule and a Cron field")
+	ErrScheduleEnd      = errors.New("Invalid Job. Job's schedule can not end before it starts")
 
 	Logger = logger.New(bytes.NewBuffer(nil))
 )
@@ -37,12 +41,33 @@ type Job struct {
 	// job after each run.
 	delayDuration *iso8601.Duration
 
+	// Parsed Cron expression, used for scheduling instead of
+	// delayDuration if the job has a Cron field.
+	cronSchedule *cron.Schedule
+
+	// Location of the TimeZone field, nil if the job has none.
+	location *time.Location
+
 	// Number of times to schedule this job after the
 	// first run.
 	timesToRepeat int64
 
+	// No run is scheduled after this time if it isn't zero. The earlier of
+	// the ScheduleEnd field and the end given in the Schedule string.
+	endTime time.Time
+
 	epsilonDuration *iso8601.Duration
 
+	misfireGrace *iso8601.Duration
+
+	jitterDuration *iso8601.Duration
+
+	// Delay of the runs within the job's jitter, see updateJitter.
+	jitter time.Duration
+
+	// Number of missed runs to fire immediately, see applyMisfirePolicy.
+	misfires int
+
 	jobTimer clock.Timer
 
 	// The clock for this job; used to mock time during tests.
@@ -50,6 +75,28 @@ type Job struct {
 
 	lock sync.RWMutex
 
+	// Cancel the running attempts by run sequence number, and the output of the
+	// latest one for the followers, nil if the job isn't running on this node.
+	// Guarded by runLock, as lock is held for the whole run.
+	cancelRuns map[int]context.CancelFunc
+	runSeq     int
+	runLog     *RunLog
+	runLock    sync.Mutex
+	// A run is queued by the "queue" OverlapPolicy, and the stats of the runs skipped
+	// by the OverlapPolicy, recorded once the runs on this node finish. Guarded by runLock too.
+	queued       bool
+	overlapStats []*types.JobStat
+
+	// Output of the last successful run since Kala started, for the dependent jobs.
+	// Guarded by runLock too.
+	lastOutput    string
+	hasLastOutput bool
+
+	// OAuth2 token of the remote Auth and when it expires, zero if it doesn't.
+	authToken       string
+	authTokenExpiry time.Time
+	authLock        sync.Mutex
+
 	// The job will send on this channel when it's done running; used for tests.
 	// Note that if the job should be rescheduled, it will send on this channel
 	// when it's done rescheduling rather than when the job is done running.
@@ -132,7 +179,7 @@ func (j *Job) Init(cache JobCache) error {
 	}
 
 	// TODO: Delete from cache after running.
-	if j.Schedule == "" {
+	if !j.hasSchedule() {
 		// If schedule is empty, its a one-off job.
 		go j.Run(cache)
 		return nil
@@ -156,44 +203,83 @@ func (j *Job) Init(cache JobCache) error {
 	return nil
 }
 
-// InitDelayDuration is used to parsed the iso8601 Schedule notation into its relevant fields in the Job struct.
+// InitDelayDuration is used to parsed the iso8601 Schedule notation (or the Cron expression)
+// into its relevant fields in the Job struct.
 // If checkTime is true, then it will return an error if the Scheduled time has passed.
 func (j *Job) InitDelayDuration(checkTime bool) error {
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
-	if j.Schedule == "" {
+	if !j.hasSchedule() {
 		return nil
 	}
+	if j.Schedule != "" && j.Cron != "" {
+		return ErrScheduleAndCron
+	}
 
 	var err error
-	splitTime := strings.Split(j.Schedule, "/")
-	if len(splitTime) != 3 { //nolint:gomnd
-		return fmt.Errorf(
-			"Schedule not formatted correctly. Should look like: R/2014-03-08T20:00:00Z/PT2H",
-		)
+	j.location = nil
+	if j.TimeZone != "" {
+		if j.location, err = time.LoadLocation(j.TimeZone); err != nil {
+			Logger.Errorf("Error loading time zone %s: %s", j.TimeZone, err)
+			return err
+		}
 	}
 
-	// Handle Repeat Amount
-	if splitTime[0] == "R" {
-		// Repeat forever
-		j.timesToRepeat = -1
+	j.endTime = j.ScheduleEnd
+	if j.Cron != "" {
+		err = j.initCron(checkTime)
 	} else {
-		j.timesToRepeat, err = strconv.ParseInt(strings.Split(splitTime[0], "R")[1], BASE_10, 0)
+		err = j.initSchedule(checkTime)
+	}
+	if err != nil {
+		return err
+	}
+	if !j.endTime.IsZero() && j.endTime.Before(j.scheduleTime) {
+		return ErrScheduleEnd
+	}
+
+	if j.Epsilon != "" {
+		j.epsilonDuration, err = iso8601.FromString(j.Epsilon)
 		if err != nil {
-			Logger.Errorf("Error converting timesToRepeat to an int: %s", err)
+			Logger.Errorf("Error converting j.Epsilon to iso8601.Duration: %s", err)
 			return err
 		}
 	}
-
-	j.scheduleTime, err = time.Parse(time.RFC3339, splitTime[1])
-	if err != nil {
-		j.scheduleTime, err = time.Parse(RFC3339WithoutTimezone, splitTime[1])
+	j.jitterDuration = nil
+	if j.Jitter != "" {
+		j.jitterDuration, err = iso8601.FromString(j.Jitter)
 		if err != nil {
-			Logger.Errorf("Error converting scheduleTime to a time.Time: %s", err)
+			Logger.Errorf("Error converting j.Jitter to iso8601.Duration: %s", err)
 			return err
 		}
 	}
+	return j.initMisfirePolicy()
+}
+
+func (j *Job) initSchedule(checkTime bool) error {
+	var err error
+	splitTime := strings.Split(j.Schedule, "/")
+	if len(splitTime) != 3 && len(splitTime) != 4 { //nolint:gomnd
+		return fmt.Errorf(
+			"Schedule not formatted correctly. Should look like: R/2014-03-08T20:00:00Z/PT2H",
+		)
+	}
+
+	// Handle Repeat Amount
+	j.timesToRepeat, err = parseTimesToRepeat(splitTime[0])
+	if err != nil {
+		return err
+	}
+
+	j.scheduleTime, err = j.parseScheduleTime(splitTime[1])
+	if err != nil {
+		Logger.Errorf("Error converting scheduleTime to a time.Time: %s", err)
+		return err
+	}
+	// Recurrences are computed on the wall clock of the job's time zone,
+	// or of the start datetime's offset if the job has none.
+	j.scheduleTime = j.scheduleTime.In(j.scheduleLocation(j.scheduleTime.Location()))
 	if checkTime {
 		diff := j.scheduleTime.Sub(j.clk.Time().Now())
 		if diff < 0 {
@@ -203,37 +289,168 @@ func (j *Job) InitDelayDuration(checkTime bool) error {
 	Logger.Debugf("Job %s:%s scheduled", j.Name, j.Id)
 	Logger.Debugf("Starting %s will repeat for %d", j.scheduleTime, j.timesToRepeat)
 
-	if j.timesToRepeat != 0 {
-		j.delayDuration, err = iso8601.FromString(splitTime[2])
+	if len(splitTime) == 4 { //nolint:gomnd
+		// R/start/duration/end
+		end, err := j.parseScheduleTime(splitTime[3])
 		if err != nil {
-			Logger.Errorf("Error converting delayDuration to a iso8601.Duration: %s", err)
+			Logger.Errorf("Error converting schedule end to a time.Time: %s", err)
 			return err
 		}
+		if j.endTime.IsZero() || end.Before(j.endTime) {
+			j.endTime = end
+		}
+	}
+
+	if j.timesToRepeat != 0 {
+		if end, err := j.parseScheduleTime(splitTime[2]); err == nil && len(splitTime) == 3 {
+			// R/start/end: as in ISO 8601, the interval between runs is the one
+			// from the start to the end datetime.
+			if !end.After(j.scheduleTime) {
+				return ErrScheduleEnd
+			}
+			j.delayDuration = &iso8601.Duration{Seconds: int(end.Sub(j.scheduleTime) / time.Second)}
+		} else {
+			j.delayDuration, err = iso8601.FromString(splitTime[2])
+			if err != nil {
+				Logger.Errorf("Error converting delayDuration to a iso8601.Duration: %s", err)
+				return err
+			}
+		}
 		Logger.Debugf("Delay duration is %s", j.delayDuration.RelativeTo(j.clk.Time().Now()))
 	}
+	return nil
+}
 
-	if j.Epsilon != "" {
-		j.epsilonDuration, err = iso8601.FromString(j.Epsilon)
+// parseScheduleTime parses a datetime of the Schedule.
+// A datetime without offset is in the job's time zone, UTC by default.
+func (j *Job) parseScheduleTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t, err = time.ParseInLocation(RFC3339WithoutTimezone, s, j.scheduleLocation(time.UTC))
+	}
+	return t, err
+}
+
+func (j *Job) initCron(checkTime bool) error {
+	var err error
+	spec := j.Cron
+
+	// Handle Repeat Amount
+	j.timesToRepeat = -1
+	if strings.HasPrefix(spec, "R") {
+		i := strings.Index(spec, "/")
+		if i < 0 {
+			return fmt.Errorf("Cron not formatted correctly. Should look like: R5/30 9 * * MON-FRI")
+		}
+		j.timesToRepeat, err = parseTimesToRepeat(spec[:i])
 		if err != nil {
-			Logger.Errorf("Error converting j.Epsilon to iso8601.Duration: %s", err)
 			return err
 		}
+		spec = spec[i+1:]
 	}
+
+	j.cronSchedule, err = cron.Parse(spec)
+	if err != nil {
+		Logger.Errorf("Error converting Cron to a cron.Schedule: %s", err)
+		return err
+	}
+
+	// The first run is the first activation after the job was created,
+	// so that a job reloaded from the db knows if it missed its first run.
+	from := j.CreatedAt
+	if checkTime || from.IsZero() {
+		from = j.clk.Time().Now()
+	}
+	j.scheduleTime = j.cronSchedule.Next(from.In(j.scheduleLocation(time.Local)))
+	if j.scheduleTime.IsZero() {
+		return fmt.Errorf("Job %s:%s cron %s never fires", j.Name, j.Id, j.Cron)
+	}
+	Logger.Debugf("Job %s:%s scheduled", j.Name, j.Id)
+	Logger.Debugf("Starting %s will repeat for %d", j.scheduleTime, j.timesToRepeat)
 	return nil
 }
 
+func parseTimesToRepeat(s string) (int64, error) {
+	if s == "R" {
+		// Repeat forever
+		return -1, nil
+	}
+	if !strings.HasPrefix(s, "R") {
+		return 0, fmt.Errorf("Repeat amount %s should start with R", s)
+	}
+	timesToRepeat, err := strconv.ParseInt(s[1:], BASE_10, 0)
+	if err != nil {
+		Logger.Errorf("Error converting timesToRepeat to an int: %s", err)
+		return 0, err
+	}
+	return timesToRepeat, nil
+}
+
 // StartWaiting begins a timer for when it should execute the Jobs .Run() method.
 func (j *Job) StartWaiting(cache JobCache, justRan bool) {
+	group := j.group()
+	jitter := j.updateJitter(group)
 	waitDuration := j.GetWaitDuration()
+	// The run point of the schedule, before the jitter and calendars delay it.
+	// The other nodes fire the same occurrence of the schedule, see start.
+	scheduledAt := j.clk.Time().Now()
+	var occurrence time.Time
+	if waitDuration > 0 {
+		scheduledAt = scheduledAt.Add(waitDuration)
+		occurrence = scheduledAt
+	}
+	if jitter > 0 {
+		if waitDuration < 0 {
+			waitDuration = 0
+		}
+		waitDuration += jitter
+	}
+	waitDuration, skipReason := j.applyCalendars(waitDuration, group)
 
+	ended := false
+	defer func() {
+		if !ended {
+			return
+		}
+		j.lock.RLock()
+		defer j.lock.RUnlock()
+		if err := cache.Set(j); err != nil {
+			Logger.Errorf("Job %s with id %s is done, but it couldn't be persisted: %v", j.Name, j.Id, err)
+		}
+	}()
 	j.lock.Lock()
 	defer j.lock.Unlock()
 
 	// Logger.Infof("Job %s:%s repeating in %s", j.Name, j.Id, waitDuration)
 
-	j.NextRunAt = j.clk.Time().Now().Add(waitDuration)
+	now := j.clk.Time().Now()
+	// The jitter and calendars may delay the next run past the end of the schedule.
+	if !j.endTime.IsZero() && now.Add(waitDuration).After(j.endTime) {
+		Logger.Infof("Job %s:%s is done, its next run would be after the end of its schedule.", j.Name, j.Id)
+		if j.jobTimer != nil {
+			j.jobTimer.Stop()
+		}
+		j.IsDone, ended = true, true
+		if justRan && j.ranChan != nil {
+			j.ranChan <- struct{}{}
+		}
+		return
+	}
+	j.NextRunAt = now.Add(waitDuration)
 
-	jobRun := func() { j.Run(cache) }
+	jobRun := func() { j.runWithOverlap(cache, &JobRunner{scheduledAt: scheduledAt, occurrence: occurrence}) }
+	if skipReason != "" {
+		skippedAt := j.NextRunAt
+		if waitDuration < 0 {
+			skippedAt = now
+		}
+		jobRun = func() { j.skipRun(cache, skippedAt, scheduledAt, skipReason) }
+	}
+	// Runs finishing together, e.g. a queued run and the run it waited for, each wait
+	// for the next run: the timer armed first is replaced, not run too.
+	if j.jobTimer != nil {
+		j.jobTimer.Stop()
+	}
 	j.jobTimer = j.clk.Time().AfterFunc(waitDuration, jobRun)
 
 	if justRan && j.ranChan != nil {
@@ -245,6 +462,15 @@ func (j *Job) GetWaitDuration() time.Duration {
 	j.lock.RLock()
 	defer j.lock.RUnlock()
 
+	return j.getWaitDuration()
+}
+
+// getWaitDuration is GetWaitDuration for callers already holding the lock.
+func (j *Job) getWaitDuration() time.Duration {
+	if j.misfires > 0 {
+		return 0
+	}
+
 	waitDuration := j.scheduleTime.Sub(j.clk.Time().Now())
 
 	if waitDuration >= 0 {
@@ -267,26 +493,47 @@ func (j *Job) GetWaitDuration() time.Duration {
 			return 0
 		}
 
-		newRunPoint := j.scheduleTime
-		for newRunPoint.Before(j.clk.Time().Now()) {
-			newRunPoint = j.delayDuration.Add(newRunPoint)
+		now := j.clk.Time().Now()
+		if j.cronSchedule != nil {
+			return j.nextRunAfter(now.Add(-time.Nanosecond)).Sub(now)
 		}
-
-		return newRunPoint.Sub(j.clk.Time().Now())
+		return j.delayDuration.Next(j.scheduleTime, now.Add(-time.Nanosecond)).Sub(now)
 	}
 
 	if j.Metadata.LastAttemptedRun.IsZero() {
-		waitDuration = j.delayDuration.RelativeTo(j.clk.Time().Now())
+		now := j.clk.Time().Now()
+		waitDuration = j.nextRunAfter(now).Sub(now)
 	} else {
-		lastRun := j.Metadata.LastAttemptedRun
 		// Needs to be recalculated each time because of Months.
-		lastRun = j.delayDuration.Add(lastRun)
+		lastRun := j.nextRunAfter(j.lastScheduledRun())
 		waitDuration = lastRun.Sub(j.clk.Time().Now())
 	}
 
 	return waitDuration
 }
 
+// nextRunAfter returns the scheduled run point following t.
+// With a time zone, ISO 8601 run points are counted from the start datetime
+// rather than from t, so that wall clock times shifted by daylight saving
+// transitions (see iso8601.Date) don't drift the following runs.
+func (j *Job) nextRunAfter(t time.Time) time.Time {
+	if j.cronSchedule != nil {
+		return j.cronSchedule.Next(t.In(j.scheduleLocation(time.Local)))
+	}
+	if j.location == nil || j.scheduleTime.IsZero() {
+		return j.delayDuration.Add(t)
+	}
+	return j.delayDuration.Next(j.scheduleTime, t)
+}
+
+// scheduleLocation returns the location of the job's time zone, or def if it has none.
+func (j *Job) scheduleLocation(def *time.Location) *time.Location {
+	if j.location != nil {
+		return j.location
+	}
+	return def
+}
+
 // Disable stops the job from running by stopping its jobTimer. It also sets Job.Disabled to true,
 // which is reflected in the UI.
 func (j *Job) Disable(cache JobCache) error {
@@ -383,7 +630,17 @@ func (j *Job) RunOnFailureJob(cache JobCache) {
 }
 
 func (j *Job) Run(cache JobCache) {
+	j.RunWithParams(cache, nil)
+}
+
+// RunWithParams runs the job with the parameters of its templates' Params.
+func (j *Job) RunWithParams(cache JobCache, params map[string]string) {
+	j.runWithOverlap(cache, &JobRunner{params: params})
+}
 
+// runWithOverlap runs the job with jobRunner, holding the parameters, overlap policy
+// and scheduled time of the run if any.
+func (j *Job) runWithOverlap(cache JobCache, jobRunner *JobRunner) {
 	_, err := cache.Get(j.Id)
 	if errors.Is(err, ErrJobDoesntExist) {
 		Logger.Infof("Job %s with id %s tried to run, but exited early because it has been deleted", j.Name, j.Id)
@@ -391,28 +648,65 @@ func (j *Job) Run(cache JobCache) {
 	}
 
 	j.lock.RLock()
-	jobRunner := &JobRunner{job: j, meta: j.Metadata}
+	jobRunner.job, jobRunner.meta = j, j.Metadata
 	j.lock.RUnlock()
 
+	if j.run(cache, jobRunner) == ErrBeyoundConcurrency {
+		go j.waitForSlot(cache, jobRunner)
+	}
+}
+
+// run runs the job with jobRunner and records the run, except if it returns
+// ErrBeyoundConcurrency: the run then waits in the queue of its group, or if the waiting run
+// is dropped as the job was deleted or disabled.
+func (j *Job) run(cache JobCache, jobRunner *JobRunner) error {
 	newStat, newMeta, err := jobRunner.Run(cache)
 	if err != nil {
-		if err == ErrJobIsRunning { // return to prevent duplicate task execution.
-			return
+		if err == ErrJobIsRunning { // apply the overlap policy to prevent duplicate task execution.
+			j.applyOverlapPolicy(cache, jobRunner, newMeta)
+			return err
 		}
-		if err == ErrBeyoundConcurrency { // reset StartWaiting when beyound concurrency jobs running
-			go j.StartWaiting(cache, true)
-			return
+		if err == ErrOccurrenceStarted { // another node runs it, wait for the next one.
+			Logger.Infof("Job %s:%s scheduled run started by another node.", j.Name, j.Id)
+			j.finishRun(cache, newMeta, nil)
+			return err
+		}
+		if err == ErrBeyoundConcurrency { // wait for a slot when beyound concurrency jobs running
+			if jobRunner.queuedAt.IsZero() {
+				jobRunner.queuedAt = j.clk.Time().Now()
+			}
+			return err
+		}
+		if !jobRunner.queuedAt.IsZero() && newStat == nil { // the waiting run didn't start.
+			if err == ErrJobDeleted || err == ErrJobDisabled {
+				Logger.Infof("Job %s:%s is deleted or disabled, its waiting run is dropped.", j.Name, j.Id)
+				return err
+			}
+			Logger.Errorf("Job %s:%s error starting its waiting run: %s", j.Name, j.Id, err)
+			return ErrBeyoundConcurrency
+		}
+		if err != ErrJobCancelled {
+			j.lock.RLock()
+			j.RunOnFailureJob(cache)
+			j.lock.RUnlock()
 		}
-		j.lock.RLock()
-		j.RunOnFailureJob(cache)
-		j.lock.RUnlock()
 	}
 
+	j.finishRun(cache, newMeta, newStat)
+	return err
+}
+
+// finishRun records the metadata and stat of a run, schedules the next run and persists the job.
+func (j *Job) finishRun(cache JobCache, newMeta types.Metadata, newStat *types.JobStat) {
 	j.lock.Lock()
 	j.Metadata = newMeta
 	if newStat != nil {
 		j.Stats = append(j.Stats, newStat)
 	}
+	j.Stats = append(j.Stats, j.takeOverlapStats()...)
+	if j.misfires > 0 {
+		j.misfires--
+	}
 	if j.ShouldStartWaiting() {
 		go j.StartWaiting(cache, true)
 	} else {
@@ -450,21 +744,48 @@ func (j *Job) RunCmd() (string, error) {
 	return jobRunner.runCmd()
 }
 
+// hasSchedule reports whether the job recurs, either on a Schedule or on a Cron.
+func (j *Job) hasSchedule() bool {
+	return j.Schedule != "" || j.Cron != ""
+}
+
 func (j *Job) hasFixedRepetitions() bool {
 	return j.timesToRepeat != -1
 }
 
+// ranRuns returns how many runs of the job ran, leaving out the skipped ones.
+func (j *Job) ranRuns() int {
+	count := 0
+	for _, stat := range j.Stats {
+		if !stat.Skipped {
+			count++
+		}
+	}
+	return count
+}
+
 func (j *Job) ShouldStartWaiting() bool {
 	if j.Disabled {
 		return false
 	}
 
-	if j.hasFixedRepetitions() && int(j.timesToRepeat) < len(j.Stats) {
+	if j.hasFixedRepetitions() && int(j.timesToRepeat) < j.ranRuns() {
+		return false
+	}
+	if j.hasEnded() {
 		return false
 	}
 	return true
 }
 
+// hasEnded reports whether the job's next run would be after the end of its schedule.
+func (j *Job) hasEnded() bool {
+	if j.endTime.IsZero() {
+		return false
+	}
+	return j.clk.Time().Now().Add(j.getWaitDuration()).After(j.endTime)
+}
+
 func (j *Job) validation() error {
 	var err error
 	switch {
@@ -475,7 +796,28 @@ func (j *Job) validation() error {
 	case j.JobType != types.LocalJob && j.JobType != types.RemoteJob:
 		err = ErrInvalidJobType
 	default:
-		return nil
+		if err = validateRetryPolicy(&j.RetryPolicy); err != nil {
+			break
+		}
+		if err = validateOverlapPolicy(j.OverlapPolicy); err != nil {
+			break
+		}
+		if err = validatePriority(j.Priority); err != nil {
+			break
+		}
+		if err = validateResponseAssertions(&j.RemoteProperties.ResponseAssertions); err != nil {
+			break
+		}
+		if err = validateRemoteAuth(&j.RemoteProperties.Auth); err != nil {
+			break
+		}
+		if hasRedactedSecret(j.Job) {
+			err = ErrRedactedSecret
+			break
+		}
+		if err = validateTransport(j.RemoteProperties.Transport); err == nil {
+			return nil
+		}
 	}
 	Logger.Errorf(err.Error())
 	return err
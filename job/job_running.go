@@ -3,127 +3,453 @@ package job
 
 import (
 	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/garyburd/redigo/redis"
 	"github.com/lovego/kala/types"
 )
 
 var (
-	runningKeyPrefix      = "kala-job-running"
-	concurrency           = 2 // max concurrency jobs for every group name
+	// Prefix of the Redis sorted sets of the leases of the running jobs of each group,
+	// "<job id>:<token>" with the unix time in milliseconds they expire at as score.
+	runningKeyPrefix = "kala-job-running:"
+	// Prefix of the Redis hashes of the nodes holding the leases of each group.
+	ownersKeyPrefix = "kala-job-running-owners:"
+	// Redis sorted set of the leases of all running jobs, for the global concurrency.
+	allRunningKey = "kala-jobs-running"
+	// Prefixes of the Redis keys of the wait queue of each group, see queue.go.
+	waitingKeyPrefix       = "kala-job-waiting:"
+	waitingExpiryKeyPrefix = "kala-job-waiting-expiry:"
+	waitingSinceKeyPrefix  = "kala-job-waiting-since:"
+	// Redis counter of the runs queued, ordering the runs queued in the same millisecond.
+	waitingSeqKey = "kala-job-waiting-seq"
+	// Prefix of the Redis hashes of the last run point of the schedule started
+	// by any node, in unix milliseconds, of the jobs of each group.
+	occurrencesKeyPrefix = "kala-job-occurrences:"
+	// Prefix of the Redis keys of the running jobs of the earlier versions,
+	// "kala-job-running-<group>-<job id>", or "kala-job-running-<job id>" without group.
+	legacyRunningKeyPrefix = "kala-job-running-"
+
+	// Default max concurrency jobs for every group name, see types.Group.Concurrency.
+	concurrency = 2
+	// GlobalConcurrency is the max number of jobs running at once across the cluster,
+	// 0 for no limit. It must be the same on all nodes.
+	GlobalConcurrency = 0
+
 	ErrJobIsRunning       = errors.New("job is running")
 	ErrBeyoundConcurrency = errors.New("beyound job concurrency")
+	ErrOccurrenceStarted  = errors.New("scheduled run started by another node")
+
+	// NodeId identifies this node as the owner of the leases of the jobs it runs.
+	// It defaults to the host name and process id, and must be unique in the cluster.
+	NodeId = defaultNodeId()
+
+	// The lease of a running job expires after leaseTTL without being renewed,
+	// so that the jobs of a crashed node can run again.
+	leaseTTL = 30 * time.Second
+
+	// reclaimLua removes the expired leases of a group, at the current time now.
+	reclaimLua = `
+local expired = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', now)
+for _, lease in ipairs(expired) do
+	redis.call('ZREM', KEYS[1], lease)
+	redis.call('HDEL', KEYS[2], lease)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[3], '-inf', now)
+for _, lease in ipairs(redis.call('ZRANGEBYSCORE', KEYS[5], '-inf', now)) do
+	redis.call('ZREM', KEYS[4], lease)
+	redis.call('ZREM', KEYS[5], lease)
+	redis.call('HDEL', KEYS[6], lease)
+end
+`
+	reclaimScript = redis.NewScript(leaseKeysCount, `local now = ARGV[1]`+reclaimLua+`return #expired`)
+
+	// startScript takes a lease of a job for a node, unless the job already runs as many
+	// times as it may, or its group or the cluster already run as many jobs as their
+	// concurrency, 0 for no limit. The runs waiting before it in the queue of its group
+	// count in the group's concurrency, and a run beyond it waits in the queue, in the
+	// order of its priority score ARGV[9] then of queuing. It returns 1 if the lease was taken, 0 if the job is running
+	// and -1 if its group or the cluster is full.
+	// The nodes fire the same run point of the schedule, ARGV[10], 0 for a run started
+	// otherwise: only the first of them goes on, the others get 2.
+	startScript = redis.NewScript(leaseKeysCount, `
+local id, lease, now, expiry, node = ARGV[1], ARGV[2], ARGV[3], ARGV[4], ARGV[5]
+local jobLimit, groupLimit, globalLimit = tonumber(ARGV[6]), tonumber(ARGV[7]), tonumber(ARGV[8])
+local occurrence = tonumber(ARGV[10])
+`+reclaimLua+`
+if occurrence > 0 and not redis.call('ZSCORE', KEYS[4], lease) then
+	if tonumber(redis.call('HGET', KEYS[8], id) or 0) >= occurrence then
+		return 2
+	end
+	redis.call('HSET', KEYS[8], id, occurrence)
+end
+local runs = 0
+for _, l in ipairs(redis.call('ZRANGE', KEYS[1], 0, -1)) do
+	if string.sub(l, 1, #id + 1) == id .. ':' then
+		runs = runs + 1
+	end
+end
+if runs >= jobLimit then
+	return 0
+end
+local waiting = redis.call('ZRANK', KEYS[4], lease)
+local ahead = waiting or redis.call('ZCARD', KEYS[4])
+if (groupLimit > 0 and redis.call('ZCARD', KEYS[1]) + ahead >= groupLimit) or
+	(globalLimit > 0 and redis.call('ZCARD', KEYS[3]) >= globalLimit) then
+	if not waiting then
+		redis.call('ZADD', KEYS[4], ARGV[9] + redis.call('INCR', KEYS[7]), lease)
+		redis.call('HSET', KEYS[6], lease, now)
+	end
+	redis.call('ZADD', KEYS[5], expiry, lease)
+	return -1
+end
+redis.call('ZREM', KEYS[4], lease)
+redis.call('ZREM', KEYS[5], lease)
+redis.call('HDEL', KEYS[6], lease)
+redis.call('ZADD', KEYS[1], expiry, lease)
+redis.call('HSET', KEYS[2], lease, node)
+redis.call('ZADD', KEYS[3], expiry, lease)
+return 1
+`)
+
+	// renewScript extends a lease if the node still holds it, and returns 1 if so.
+	renewScript = redis.NewScript(leaseKeysCount, `
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[3] then
+	return 0
+end
+redis.call('ZADD', KEYS[1], 'XX', ARGV[2], ARGV[1])
+redis.call('ZADD', KEYS[3], 'XX', ARGV[2], ARGV[1])
+return 1
+`)
+
+	// releaseScript removes a lease if the node holds it.
+	releaseScript = redis.NewScript(leaseKeysCount, `
+if redis.call('HGET', KEYS[2], ARGV[1]) ~= ARGV[2] then
+	return 0
+end
+redis.call('ZREM', KEYS[1], ARGV[1])
+redis.call('HDEL', KEYS[2], ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+return 1
+`)
 )
 
-// clear all running jobs (used for app start)
-func clear(jobs ...*Job) error {
+func defaultNodeId() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "kala"
+	}
+	return fmt.Sprintf("%s:%d", host, os.Getpid())
+}
+
+// reclaimExpired removes the expired leases of the groups of the jobs (used for app start),
+// those of the nodes which crashed while running them.
+func reclaimExpired(jobs ...*Job) error {
 	if len(jobs) == 0 {
 		return nil
 	}
-	runningKeys := make([]interface{}, len(jobs))
-	for i := range jobs {
-		runningKeys[i] = runningKey(jobs[i].GroupName, jobs[i].Id)
-	}
 	conn := pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("DEL", runningKeys...)
+	for group := range jobIdsByGroup(jobs) {
+		n, err := redis.Int(reclaimScript.Do(conn, leaseKeys(group, nowMillis())...))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			Logger.Infof("Reclaimed %d expired leases of group %q.", n, group)
+		}
+	}
+	// The keys of the earlier versions aren't used anymore.
+	legacyKeys := make([]interface{}, len(jobs))
+	for i, j := range jobs {
+		legacyKeys[i] = legacyRunningKey(j.GroupName, j.Id)
+	}
+	_, err := conn.Do("DEL", legacyKeys...)
 	return err
 }
 
-// job start
-func (j *Job) start() error {
+func legacyRunningKey(groupName, id string) string {
+	if groupName == "" {
+		return legacyRunningKeyPrefix + id
+	}
+	return legacyRunningKeyPrefix + groupName + "-" + id
+}
+
+// forgetOccurrence removes the last run point of the schedule started of a deleted job.
+func forgetOccurrence(groupName, id string) {
+	if pool == nil {
+		return
+	}
 	conn := pool.Get()
 	defer conn.Close()
-	jobIds, err := groupRunningJobs(conn, j.GroupName)
+	if _, err := conn.Do("HDEL", occurrencesKeyPrefix+groupName, id); err != nil {
+		Logger.Errorf("Job %s error forgetting its last run point: %s", id, err)
+	}
+}
+
+// job start: take a lease of it for this node, to renew and release it, see newLease.
+// The lease waits in the queue of the job's group if it returns ErrBeyoundConcurrency.
+// occurrence is the run point of the schedule the run was fired for, zero for a run
+// started otherwise; it returns ErrOccurrenceStarted if another node already fired it.
+func (j *Job) start(lease string, occurrence time.Time) error {
+	g, err := getGroup(j.GroupName)
 	if err != nil {
 		return err
 	}
-	if len(jobIds) >= concurrency {
-		return ErrBeyoundConcurrency
-	}
-	ok, err := j.setRunning(conn)
+	now := time.Now()
+	conn := pool.Get()
+	defer conn.Close()
+	started, err := redis.Int(startScript.Do(conn, leaseKeys(j.GroupName,
+		j.Id, lease, toMillis(now), toMillis(now.Add(leaseTTL)), NodeId,
+		j.maxParallel(), groupLimit(j.GroupName, g), GlobalConcurrency, j.queuePriority(g),
+		occurrenceMillis(occurrence),
+	)...))
 	if err != nil {
 		return err
 	}
-	if !ok {
+	switch started {
+	case 0:
 		return ErrJobIsRunning
+	case -1:
+		return ErrBeyoundConcurrency
+	case 2:
+		return ErrOccurrenceStarted
 	}
 	return nil
 }
 
-// job finished
-func (j *Job) finish() error {
+// occurrenceMillis returns the run point of the schedule t in unix milliseconds, 0 if zero.
+func occurrenceMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return toMillis(t)
+}
+
+// newLease returns the id of a new lease of the job.
+func (j *Job) newLease() string {
+	return j.Id + ":" + newRunId()
+}
+
+// maxParallel returns the max number of runs of the job at once.
+func (j *Job) maxParallel() int {
+	if j.MaxParallel == 0 {
+		return 1
+	}
+	return int(j.MaxParallel)
+}
+
+// groupConcurrency returns the max number of jobs of a group running at once, 0 for no limit.
+func groupConcurrency(name string) (int, error) {
+	g, err := getGroup(name)
+	if err != nil {
+		return 0, err
+	}
+	return groupLimit(name, g), nil
+}
+
+// groupLimit is groupConcurrency for the settings g of the group, nil if it has none.
+// The jobs without a group don't limit each other.
+func groupLimit(name string, g *types.Group) int {
+	switch {
+	case name == "":
+		return 0
+	case g == nil || g.Concurrency == 0:
+		return concurrency
+	case g.Concurrency < 0:
+		return 0
+	default:
+		return g.Concurrency
+	}
+}
+
+// renew extends a lease of the job, and returns false if this node no longer holds it.
+func (j *Job) renew(lease string) (bool, error) {
 	conn := pool.Get()
 	defer conn.Close()
-	_, err := conn.Do("DEL", runningKey(j.GroupName, j.Id))
-	return err
+	return redis.Bool(renewScript.Do(conn, leaseKeys(j.GroupName,
+		lease, toMillis(time.Now().Add(leaseTTL)), NodeId,
+	)...))
 }
 
-// set job running
-func (j *Job) setRunning(conn redis.Conn) (bool, error) {
-	reply, err := redis.String(conn.Do("SET", runningKey(j.GroupName, j.Id), j.Id, "NX"))
-	if err != nil && err != redis.ErrNil {
-		return false, err
-	}
-	return reply == "OK", nil
+// heartbeat renews a lease of the job until the returned function is called.
+func (j *Job) heartbeat(lease string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(leaseTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if ok, err := j.renew(lease); err != nil {
+					Logger.Errorf("Job %s:%s renewing lease error: %s.", j.Name, j.Id, err)
+				} else if !ok {
+					Logger.Errorf("Job %s:%s lost its lease.", j.Name, j.Id)
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// job finished: release its lease, if this node still holds it.
+func (j *Job) finish(lease string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := releaseScript.Do(conn, leaseKeys(j.GroupName, lease, NodeId)...)
+	return err
 }
 
 // job running stat
 func (j *Job) isRunning() (bool, error) {
 	conn := pool.Get()
 	defer conn.Close()
-	reply, err := redis.Int(conn.Do("EXISTS", runningKey(j.GroupName, j.Id)))
-	if err != nil && err != redis.ErrNil {
+	running, err := groupRunningJobs(conn, j.GroupName)
+	if err != nil {
 		return false, err
 	}
-	return reply == 1, nil
+	_, ok := running[j.Id]
+	return ok, nil
 }
 
-// get running jobs
-func groupRunningJobs(conn redis.Conn, group string) ([]string, error) {
-	jobs, err := redis.Strings(conn.Do("KEYS", runningKey(group, "")))
-	if err != nil && err != redis.ErrNil {
+// groupRunningJobs returns a node running each running job of a group, by job id.
+func groupRunningJobs(conn redis.Conn, group string) (map[string]string, error) {
+	leases, err := redis.Strings(conn.Do("ZRANGEBYSCORE", runningKey(group), fmt.Sprintf("(%d", nowMillis()), "+inf"))
+	if err != nil || len(leases) == 0 {
 		return nil, err
 	}
-	return jobs, nil
+	nodes, err := redis.Strings(conn.Do("HMGET", redis.Args{}.Add(ownersKey(group)).AddFlat(leases)...))
+	if err != nil {
+		return nil, err
+	}
+	running := make(map[string]string, len(leases))
+	for i, lease := range leases {
+		if k := strings.IndexByte(lease, ':'); k > 0 {
+			running[lease[:k]] = nodes[i]
+		}
+	}
+	return running, nil
 }
 
-func runningKey(groupName, id string) string {
-	var key = runningKeyPrefix
-	if groupName != "" {
-		key += "-" + groupName
-	}
-	if id != "" {
-		key += "-" + id
+// countRunning returns the number of unexpired leases of a sorted set.
+func countRunning(conn redis.Conn, key string) (int, error) {
+	return redis.Int(conn.Do("ZCOUNT", key, fmt.Sprintf("(%d", nowMillis()), "+inf"))
+}
+
+func runningKey(groupName string) string {
+	return runningKeyPrefix + groupName
+}
+
+func ownersKey(groupName string) string {
+	return ownersKeyPrefix + groupName
+}
+
+// Number of keys returned by leaseKeys.
+const leaseKeysCount = 8
+
+// leaseKeys returns the keys of the leases and of the wait queue of a group,
+// followed by args, for the scripts.
+func leaseKeys(groupName string, args ...interface{}) []interface{} {
+	return append([]interface{}{
+		runningKey(groupName), ownersKey(groupName), allRunningKey,
+		waitingKeyPrefix + groupName, waitingExpiryKeyPrefix + groupName, waitingSinceKeyPrefix + groupName,
+		waitingSeqKey, occurrencesKeyPrefix + groupName,
+	}, args...)
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func nowMillis() int64 {
+	return toMillis(time.Now())
+}
+
+func jobIdsByGroup(jobs []*Job) map[string][]string {
+	groups := map[string][]string{}
+	for _, j := range jobs {
+		groups[j.GroupName] = append(groups[j.GroupName], j.Id)
 	}
-	return key
+	return groups
 }
 
+// JobsRunning sets the IsRunning and RunningOn of the jobs running on any node.
 func JobsRunning(jobs map[string]*types.Job) error {
-	if len(jobs) == 0 {
-		return nil
-	}
-	runningKeys := make([]interface{}, 0, len(jobs))
+	groups := map[string]bool{}
 	for k := range jobs {
-		if jobs[k].Disabled || jobs[k].Deleted || jobs[k].IsDone {
+		if !mayRun(jobs[k]) {
 			continue
 		}
-		runningKeys = append(runningKeys, runningKey(jobs[k].GroupName, jobs[k].Id))
+		groups[jobs[k].GroupName] = true
 	}
-	if len(runningKeys) == 0 {
+	if len(groups) == 0 {
 		return nil
 	}
 	conn := pool.Get()
 	defer conn.Close()
-	running, err := redis.Strings(conn.Do("MGET", runningKeys...))
-	if err != nil && err != redis.ErrNil {
-		return err
-	}
-	for i := range running {
-		if _, ok := jobs[running[i]]; !ok {
-			continue
+	for group := range groups {
+		running, err := groupRunningJobs(conn, group)
+		if err != nil {
+			return err
+		}
+		for id, node := range running {
+			if j, ok := jobs[id]; ok && j.GroupName == group && mayRun(j) {
+				j.IsRunning = true
+				j.RunningOn = node
+			}
 		}
-		jobs[running[i]].IsRunning = true
 	}
 	return nil
 }
+
+// concurrencyStats returns the slots used and available and the runs waiting for one
+// across the cluster and in the groups, by name, for the KalaStats.
+func concurrencyStats(groups []string) (types.ConcurrencyStats, map[string]types.ConcurrencyStats, error) {
+	global := types.ConcurrencyStats{Limit: GlobalConcurrency}
+	conn := pool.Get()
+	defer conn.Close()
+	var err error
+	if global.Running, err = countRunning(conn, allRunningKey); err != nil {
+		return global, nil, err
+	}
+	stats := make(map[string]types.ConcurrencyStats, len(groups))
+	var maxWait time.Duration
+	// The runs without a group wait only for the global concurrency.
+	for _, group := range append([]string{""}, groups...) {
+		s := types.ConcurrencyStats{}
+		if s.Limit, err = groupConcurrency(group); err != nil {
+			return global, nil, err
+		}
+		if s.Running, err = countRunning(conn, runningKey(group)); err != nil {
+			return global, nil, err
+		}
+		waiting, wait, err := queueStats(conn, group)
+		if err != nil {
+			return global, nil, err
+		}
+		if s.Waiting = waiting; waiting > 0 {
+			s.MaxWait = wait.Round(time.Millisecond).String()
+		}
+		global.Waiting += waiting
+		if wait > maxWait {
+			maxWait = wait
+		}
+		if group != "" {
+			stats[group] = s
+		}
+	}
+	if global.Waiting > 0 {
+		global.MaxWait = maxWait.Round(time.Millisecond).String()
+	}
+	return global, stats, nil
+}
+
+func mayRun(j *types.Job) bool {
+	return !j.Disabled && !j.Deleted && !j.IsDone
+}
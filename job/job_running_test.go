@@ -0,0 +1,213 @@
+package job
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRunningMockJob(group string) *Job {
+	j := GetMockJob()
+	j.Id = newRunId()
+	j.GroupName = group
+	return j
+}
+
+func startMockJob(t *testing.T, j *Job) string {
+	lease := j.newLease()
+	assert.NoError(t, j.start(lease, time.Time{}))
+	return lease
+}
+
+func TestJobRunningConcurrency(t *testing.T) {
+	group := fmt.Sprintf("running-%d", time.Now().UnixNano())
+	j1, j2, j3 := newRunningMockJob(group), newRunningMockJob(group), newRunningMockJob(group)
+	// A group sharing the prefix of the other one doesn't count in its concurrency.
+	other := newRunningMockJob(group + "0")
+	defer other.finish(startMockJob(t, other))
+
+	lease1 := startMockJob(t, j1)
+	err := j1.start(j1.newLease(), time.Time{})
+	assert.Equal(t, ErrJobIsRunning, err)
+	lease2 := startMockJob(t, j2)
+	// j3 waits in the queue of the group.
+	lease3 := j3.newLease()
+	assert.Equal(t, ErrBeyoundConcurrency, j3.start(lease3, time.Time{}))
+
+	jobs := map[string]*types.Job{j1.Id: j1.Job, j2.Id: j2.Job, j3.Id: j3.Job}
+	assert.NoError(t, JobsRunning(jobs))
+	assert.True(t, j1.IsRunning)
+	assert.True(t, j2.IsRunning)
+	assert.False(t, j3.IsRunning)
+
+	assert.NoError(t, j1.finish(lease1))
+	running, err := j1.isRunning()
+	assert.NoError(t, err)
+	assert.False(t, running)
+	assert.NoError(t, j3.start(lease3, time.Time{}))
+
+	assert.NoError(t, j2.finish(lease2))
+	assert.NoError(t, j3.finish(lease3))
+}
+
+func TestJobRunningWithoutGroup(t *testing.T) {
+	jobs := []*Job{GetMockJob(), GetMockJob(), GetMockJob()}
+	for _, j := range jobs {
+		j.Id = newRunId()
+		defer j.finish(startMockJob(t, j))
+	}
+}
+
+func TestJobRunningLimits(t *testing.T) {
+	group := fmt.Sprintf("limits-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 3}))
+	defer DeleteGroup(group)
+
+	j1, j2 := newRunningMockJob(group), newRunningMockJob(group)
+	j1.MaxParallel = 2
+	lease1 := startMockJob(t, j1)
+	lease2 := startMockJob(t, j1)
+	err := j1.start(j1.newLease(), time.Time{})
+	assert.Equal(t, ErrJobIsRunning, err)
+	lease3 := startMockJob(t, j2)
+	j3 := newRunningMockJob(group)
+	lease4 := j3.newLease()
+	assert.Equal(t, ErrBeyoundConcurrency, j3.start(lease4, time.Time{}))
+	defer j3.dequeue(lease4)
+
+	global, groups, err := concurrencyStats([]string{group})
+	assert.NoError(t, err)
+	assert.True(t, global.Running >= 3)
+	assert.Equal(t, 3, groups[group].Running)
+	assert.Equal(t, 3, groups[group].Limit)
+	assert.Equal(t, 1, groups[group].Waiting)
+	assert.NotEmpty(t, groups[group].MaxWait)
+
+	assert.NoError(t, j1.finish(lease1))
+	running, err := j1.isRunning()
+	assert.NoError(t, err)
+	assert.True(t, running)
+	assert.NoError(t, j1.finish(lease2))
+	running, err = j1.isRunning()
+	assert.NoError(t, err)
+	assert.False(t, running)
+	assert.NoError(t, j2.finish(lease3))
+
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: -1}))
+	for i := 0; i < 3; i++ {
+		j := newRunningMockJob(group)
+		defer j.finish(startMockJob(t, j))
+	}
+}
+
+func TestJobRunningGlobalConcurrency(t *testing.T) {
+	defer func(key string) { allRunningKey = key }(allRunningKey)
+	allRunningKey = fmt.Sprintf("kala-jobs-running-test-%d", time.Now().UnixNano())
+	GlobalConcurrency = 1
+	defer func() { GlobalConcurrency = 0 }()
+
+	j1, j2 := newRunningMockJob(""), newRunningMockJob("")
+	lease := startMockJob(t, j1)
+	lease2 := j2.newLease()
+	assert.Equal(t, ErrBeyoundConcurrency, j2.start(lease2, time.Time{}))
+	global, _, err := concurrencyStats(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, global.Running)
+	assert.Equal(t, 1, global.Limit)
+	assert.True(t, global.Waiting >= 1)
+
+	assert.NoError(t, j1.finish(lease))
+	assert.NoError(t, j2.start(lease2, time.Time{}))
+	assert.NoError(t, j2.finish(lease2))
+}
+
+func TestJobRunningLeases(t *testing.T) {
+	group := fmt.Sprintf("leases-%d", time.Now().UnixNano())
+	j1, j2 := newRunningMockJob(group), newRunningMockJob(group)
+	lease := startMockJob(t, j1)
+	defer j1.finish(lease)
+
+	// A lease of j2 taken by a node which crashed.
+	conn := pool.Get()
+	defer conn.Close()
+	crashed := j2.Id + ":crashed"
+	_, err := conn.Do("ZADD", runningKey(group), nowMillis()-1, crashed)
+	assert.NoError(t, err)
+	_, err = conn.Do("HSET", ownersKey(group), crashed, "crashed")
+	assert.NoError(t, err)
+
+	running, err := j2.isRunning()
+	assert.NoError(t, err)
+	assert.False(t, running)
+	jobs := map[string]*types.Job{j1.Id: j1.Job, j2.Id: j2.Job}
+	assert.NoError(t, JobsRunning(jobs))
+	assert.True(t, j1.IsRunning)
+	assert.Equal(t, NodeId, j1.RunningOn)
+	assert.False(t, j2.IsRunning)
+
+	// And the key of j2 left by an earlier version.
+	_, err = conn.Do("SET", legacyRunningKey(group, j2.Id), j2.Id)
+	assert.NoError(t, err)
+
+	assert.NoError(t, reclaimExpired(j1, j2))
+	n, err := redis.Int(conn.Do("ZCARD", runningKey(group)))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, err = redis.Int(conn.Do("EXISTS", legacyRunningKey(group, j2.Id)))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	running, err = j1.isRunning()
+	assert.NoError(t, err)
+	assert.True(t, running)
+
+	before, err := redis.Int64(conn.Do("ZSCORE", runningKey(group), lease))
+	assert.NoError(t, err)
+	time.Sleep(2 * time.Millisecond)
+	ok, err := j1.renew(lease)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	after, err := redis.Int64(conn.Do("ZSCORE", runningKey(group), lease))
+	assert.NoError(t, err)
+	assert.True(t, after > before)
+
+	// A lease taken over by another node is neither renewed nor released by this one.
+	_, err = conn.Do("HSET", ownersKey(group), lease, "other")
+	assert.NoError(t, err)
+	ok, err = j1.renew(lease)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, j1.finish(lease))
+	running, err = j1.isRunning()
+	assert.NoError(t, err)
+	assert.True(t, running)
+	_, err = conn.Do("HSET", ownersKey(group), lease, NodeId)
+	assert.NoError(t, err)
+	assert.NoError(t, j1.finish(lease))
+	running, err = j1.isRunning()
+	assert.NoError(t, err)
+	assert.False(t, running)
+}
+
+func TestJobRunningDeleteForgetsOccurrence(t *testing.T) {
+	group := fmt.Sprintf("forget-%d", time.Now().UnixNano())
+	cache := NewMockCache()
+	j := newRunningMockJob(group)
+	assert.NoError(t, cache.Set(j))
+	lease := j.newLease()
+	assert.NoError(t, j.start(lease, time.Now()))
+	assert.NoError(t, j.finish(lease))
+
+	conn := pool.Get()
+	defer conn.Close()
+	n, err := redis.Int(conn.Do("HEXISTS", occurrencesKeyPrefix+group, j.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.NoError(t, cache.Delete(j.Id, false))
+	n, err = redis.Int(conn.Do("HEXISTS", occurrencesKeyPrefix+group, j.Id))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
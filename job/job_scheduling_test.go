@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +46,140 @@ func TestGetWatiDuration(t *testing.T) {
 		assert.InDelta(t, float64(testStruct.ExpectedDuration), float64(actualDuration), float64(time.Millisecond*50), "Test of "+testStruct.Name)
 	}
 }
+
+func TestGetWaitDurationCron(t *testing.T) {
+	now := time.Date(2021, time.January, 30, 10, 15, 0, 0, time.UTC) // Saturday
+	clk := clock.NewMockClock(now)
+
+	j := &Job{Job: &types.Job{Cron: "30 9 * * MON-FRI"}}
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.Equal(t, int64(-1), j.timesToRepeat)
+	assert.Equal(t, 47*time.Hour+15*time.Minute, j.GetWaitDuration())
+
+	// After a run, wait for the next activation.
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.February, 1, 9, 30, 0, 0, time.UTC)
+	clk.SetTime(j.Metadata.LastAttemptedRun.Add(time.Minute))
+	assert.Equal(t, 24*time.Hour-time.Minute, j.GetWaitDuration())
+
+	// A missed run is run immediately, as with ISO 8601 schedules.
+	clk.SetTime(time.Date(2021, time.February, 3, 9, 0, 0, 0, time.UTC))
+	assert.True(t, j.GetWaitDuration() < 0)
+
+	// Unless the job resumes at the next scheduled time.
+	j.ResumeAtNextScheduledTime = true
+	assert.Equal(t, 30*time.Minute, j.GetWaitDuration())
+}
+
+func TestCronRepeat(t *testing.T) {
+	j := &Job{Job: &types.Job{Cron: "R2/@daily"}}
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.Equal(t, int64(2), j.timesToRepeat)
+	assert.Equal(t, "@daily", j.cronSchedule.String())
+
+	for _, spec := range []string{"R2", "RX/@daily", "61 * * * *"} {
+		j = &Job{Job: &types.Job{Cron: spec}}
+		assert.Error(t, j.InitDelayDuration(true), spec)
+	}
+
+	j = &Job{Job: &types.Job{Cron: "@daily", Schedule: "R/2021-01-30T10:15:00Z/P1D"}}
+	assert.Equal(t, ErrScheduleAndCron, j.InitDelayDuration(true))
+}
+
+func TestGetWaitDurationTimeZone(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	clk := clock.NewMockClock(time.Date(2021, time.March, 12, 0, 0, 0, 0, loc))
+
+	// The start datetime has no offset, so it is read in the job's time zone.
+	j := &Job{Job: &types.Job{Schedule: "R/2021-03-13T09:00:00/P1D", TimeZone: "America/New_York"}}
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.Equal(t, time.Date(2021, time.March, 13, 9, 0, 0, 0, loc), j.scheduleTime)
+
+	// The run after the daylight saving transition keeps its time of day.
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.March, 13, 9, 0, 0, 0, loc)
+	clk.SetTime(j.Metadata.LastAttemptedRun.Add(time.Minute))
+	assert.Equal(t, 23*time.Hour-time.Minute, j.GetWaitDuration())
+
+	j = &Job{Job: &types.Job{Cron: "0 9 * * *", TimeZone: "America/New_York"}}
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.Equal(t, time.Date(2021, time.March, 14, 9, 0, 0, 0, loc), j.scheduleTime)
+
+	j = &Job{Job: &types.Job{Cron: "0 9 * * *", TimeZone: "Mars/Olympus_Mons"}}
+	assert.Error(t, j.InitDelayDuration(true))
+}
+
+func TestScheduleEnd(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewMockClock(start.Add(-time.Hour))
+
+	j := &Job{Job: &types.Job{Schedule: "R/2021-01-01T09:00:00Z/P1D/2021-01-03T09:00:00Z"}}
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.Equal(t, time.Date(2021, time.January, 3, 9, 0, 0, 0, time.UTC), j.endTime)
+	assert.True(t, j.ShouldStartWaiting())
+
+	// The run at the end is the last one.
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.January, 2, 9, 0, 0, 0, time.UTC)
+	clk.SetTime(j.Metadata.LastAttemptedRun)
+	assert.True(t, j.ShouldStartWaiting())
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.January, 3, 9, 0, 0, 0, time.UTC)
+	clk.SetTime(j.Metadata.LastAttemptedRun)
+	assert.False(t, j.ShouldStartWaiting())
+
+	// The earlier of the field and the schedule string wins.
+	j = &Job{Job: &types.Job{
+		Cron:        "@daily",
+		TimeZone:    "UTC",
+		ScheduleEnd: time.Date(2021, time.January, 2, 12, 0, 0, 0, time.UTC),
+	}}
+	clk = clock.NewMockClock(start)
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(true))
+	assert.True(t, j.ShouldStartWaiting())
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.January, 2, 0, 0, 0, 0, time.UTC)
+	clk.SetTime(j.Metadata.LastAttemptedRun.Add(time.Second))
+	assert.False(t, j.ShouldStartWaiting())
+
+	j = &Job{Job: &types.Job{
+		Schedule:    "R/2021-01-01T09:00:00Z/P1D/2021-02-01T00:00:00Z",
+		ScheduleEnd: time.Date(2021, time.January, 5, 0, 0, 0, 0, time.UTC),
+	}}
+	assert.NoError(t, j.InitDelayDuration(false))
+	assert.Equal(t, j.ScheduleEnd, j.endTime)
+
+	// R/start/end repeats the interval from start to end.
+	j = &Job{Job: &types.Job{Schedule: "R/2021-01-01T09:00:00Z/2021-01-01T09:30:00Z"}}
+	assert.NoError(t, j.InitDelayDuration(false))
+	assert.Equal(t, 30*time.Minute, j.delayDuration.RelativeTo(start))
+	assert.True(t, j.endTime.IsZero())
+
+	for _, schedule := range []string{
+		"R/2021-01-01T09:00:00Z/P1D/2020-12-31T00:00:00Z",
+		"R/2021-01-01T09:00:00Z/2021-01-01T08:00:00Z",
+	} {
+		j = &Job{Job: &types.Job{Schedule: schedule}}
+		assert.Equal(t, ErrScheduleEnd, j.InitDelayDuration(false), schedule)
+	}
+}
+
+func TestScheduleEndAfterJitter(t *testing.T) {
+	start := time.Date(2021, time.January, 1, 9, 0, 0, 0, time.UTC)
+	clk := clock.NewMockClock(start.Add(-time.Hour))
+	cache := NewMockCache()
+
+	// The schedule ends at its first run point, which the jitter delays past the end.
+	j := GetMockJobWithSchedule(2, start, "P1D")
+	j.ScheduleEnd = start
+	j.Jitter = "PT10M"
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.Init(cache))
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.True(t, j.jitter > 0)
+	assert.True(t, j.IsDone)
+	assert.Nil(t, j.jobTimer)
+}
@@ -0,0 +1,157 @@
+package job
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/lovego/kala/types"
+	uuid "github.com/nu7hatch/gouuid"
+)
+
+var (
+	// LogStore keeps the full output of the runs of jobs, in the
+	// "kala-runs" directory of the temporary directory by default.
+	LogStore RunLogStore = NewFileLogStore(filepath.Join(os.TempDir(), "kala-runs"))
+
+	ErrRunLogDoesntExist = errors.New("The run log you requested does not exist")
+	ErrInvalidRunId      = errors.New("Invalid run id")
+)
+
+// RunLogStore keeps the full output of the runs of jobs,
+// the stdout and stderr of local jobs, or the response of remote jobs.
+type RunLogStore interface {
+	// Create returns a writer of the output of a run.
+	Create(jobId, runId string) (io.WriteCloser, error)
+	// Open returns a reader of the output of a run, ErrRunLogDoesntExist if there is none.
+	Open(jobId, runId string) (io.ReadCloser, error)
+	// Delete deletes the output of a run.
+	Delete(jobId, runId string) error
+	// DeleteJob deletes the output of all the runs of a job.
+	DeleteJob(jobId string) error
+}
+
+// FileLogStore keeps the output of each run in a file named after the
+// run id, in a directory named after the job id.
+type FileLogStore struct {
+	dir string
+}
+
+func NewFileLogStore(dir string) *FileLogStore {
+	return &FileLogStore{dir: dir}
+}
+
+func (s *FileLogStore) Create(jobId, runId string) (io.WriteCloser, error) {
+	path, err := s.path(jobId, runId)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil { //nolint:gomnd
+		return nil, err
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0640) //nolint:gomnd
+}
+
+func (s *FileLogStore) Open(jobId, runId string) (io.ReadCloser, error) {
+	path, err := s.path(jobId, runId)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, ErrRunLogDoesntExist
+	}
+	return f, err
+}
+
+func (s *FileLogStore) Delete(jobId, runId string) error {
+	path, err := s.path(jobId, runId)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (s *FileLogStore) DeleteJob(jobId string) error {
+	if err := checkLogId(jobId); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(s.dir, jobId))
+}
+
+func (s *FileLogStore) path(jobId, runId string) (string, error) {
+	if err := checkLogId(jobId); err != nil {
+		return "", err
+	}
+	if err := checkLogId(runId); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.dir, jobId, runId+".log"), nil
+}
+
+// checkLogId checks an id can't escape the directory of the store.
+func checkLogId(id string) error {
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return ErrInvalidRunId
+	}
+	return nil
+}
+
+// deleteRunLogs deletes the output of the runs of stats from the LogStore.
+func deleteRunLogs(jobId string, stats []*types.JobStat) {
+	if LogStore == nil {
+		return
+	}
+	for _, stat := range stats {
+		if stat.RunId == "" {
+			continue
+		}
+		if err := LogStore.Delete(jobId, stat.RunId); err != nil {
+			Logger.Errorf("Job %s error deleting the log of run %s: %s", jobId, stat.RunId, err)
+		}
+	}
+}
+
+// deleteJobRunLogs deletes the output of all the runs of a job from the LogStore.
+func deleteJobRunLogs(jobId string) {
+	if LogStore == nil {
+		return
+	}
+	if err := LogStore.DeleteJob(jobId); err != nil {
+		Logger.Errorf("Job %s error deleting the logs of its runs: %s", jobId, err)
+	}
+}
+
+// newRunId returns a new unique run id.
+func newRunId() string {
+	u4, err := uuid.NewV4()
+	if err != nil {
+		Logger.Errorf("Error occurred when generating uuid: %s", err)
+		return ""
+	}
+	return u4.String()
+}
+
+// lockedWriter serializes the writes of the stdout and stderr of a run.
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.WriteCloser
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.w.Write(p)
+}
+
+func (w *lockedWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.w.Close()
+}
@@ -0,0 +1,97 @@
+package job
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func readRunLog(t *testing.T, jobId, runId string) string {
+	r, err := LogStore.Open(jobId, runId)
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	return string(b)
+}
+
+func TestFileLogStore(t *testing.T) {
+	s := NewFileLogStore(t.TempDir())
+
+	w, err := s.Create("job", "run")
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("output"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	r, err := s.Open("job", "run")
+	assert.NoError(t, err)
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+	assert.Equal(t, "output", string(b))
+
+	assert.NoError(t, s.Delete("job", "run"))
+	_, err = s.Open("job", "run")
+	assert.Equal(t, ErrRunLogDoesntExist, err)
+	assert.NoError(t, s.DeleteJob("job"))
+
+	for _, id := range []string{"", "..", "../job", `a\b`} {
+		_, err = s.Open("job", id)
+		assert.Equal(t, ErrInvalidRunId, err, id)
+	}
+}
+
+func TestRunLogStored(t *testing.T) {
+	defer func(s RunLogStore) { LogStore = s }(LogStore)
+	LogStore = NewFileLogStore(t.TempDir())
+
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = `bash -c 'echo out; sleep 0.1; echo err >&2'`
+	j.OutputLimit = 2
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	stat := j.Stats[0]
+	j.lock.RUnlock()
+	assert.NotEmpty(t, stat.RunId)
+	assert.True(t, stat.OutputTruncated)
+	// The stored log isn't truncated.
+	assert.Equal(t, "out\nerr\n", readRunLog(t, j.Id, stat.RunId))
+
+	cache.compactJobStats(j)
+	assert.NoError(t, cache.Delete(j.Id, false))
+	_, err := LogStore.Open(j.Id, stat.RunId)
+	assert.Equal(t, ErrRunLogDoesntExist, err)
+}
+
+func TestRemoteJobRunId(t *testing.T) {
+	defer func(s RunLogStore) { LogStore = s }(LogStore)
+	LogStore = NewFileLogStore(t.TempDir())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.Query().Get("runId") + " " + r.Header.Get("runId")))
+	}))
+	defer srv.Close()
+
+	cache := NewMockCache()
+	j := GetMockRemoteJob(types.RemoteProperties{Url: srv.URL})
+	j.Schedule = GetMockJobWithGenericSchedule(time.Now()).Schedule
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	stat := j.Stats[0]
+	j.lock.RUnlock()
+	assert.Equal(t, stat.RunId+" "+stat.RunId, stat.Response)
+	assert.Equal(t, stat.Response, readRunLog(t, j.Id, stat.RunId))
+}
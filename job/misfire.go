@@ -0,0 +1,125 @@
+package job
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+const (
+	DefaultMisfireLimit = 10
+
+	// Maximum number of missed runs handled, the latest ones, e.g. for a job
+	// running every second while Kala was down for days.
+	maxMissedRuns = 1000
+	// Maximum number of missed runs looked for.
+	maxMissedRunsScanned = 1000000
+)
+
+func (j *Job) initMisfirePolicy() error {
+	j.misfireGrace = nil
+	switch j.MisfirePolicy {
+	case "", types.MisfireFireOnce, types.MisfireFireAll, types.MisfireSkip:
+	case types.MisfireGrace:
+		if j.MisfireGrace == "" {
+			return fmt.Errorf("Job %s:%s misfire policy %s needs a misfire grace", j.Name, j.Id, j.MisfirePolicy)
+		}
+	default:
+		return fmt.Errorf("Job %s:%s has an invalid misfire policy %s", j.Name, j.Id, j.MisfirePolicy)
+	}
+	if j.MisfireGrace != "" {
+		var err error
+		j.misfireGrace, err = iso8601.FromString(j.MisfireGrace)
+		if err != nil {
+			Logger.Errorf("Error converting j.MisfireGrace to iso8601.Duration: %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMisfirePolicy handles the runs missed while the job wasn't scheduled, e.g.
+// while Kala was down, according to its MisfirePolicy. The missed runs to fire are
+// run as soon as the job starts waiting, the others are recorded as skipped.
+func (j *Job) applyMisfirePolicy() {
+	j.updateJitter(j.group())
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.MisfirePolicy == "" || j.Disabled || j.IsDone || !j.hasSchedule() {
+		return
+	}
+	now := j.clk.Time().Now()
+	missed, dropped := j.missedRuns(now)
+	if len(missed) == 0 {
+		return
+	}
+	if dropped > 0 {
+		Logger.Errorf("Job %s:%s missed too many runs, %d of them are not recorded.", j.Name, j.Id, dropped)
+	}
+
+	fire := 0
+	switch j.MisfirePolicy {
+	case types.MisfireFireOnce:
+		fire = 1
+	case types.MisfireFireAll:
+		fire = DefaultMisfireLimit
+		if j.MisfireLimit > 0 {
+			fire = int(j.MisfireLimit)
+		}
+	case types.MisfireGrace:
+		last := missed[len(missed)-1]
+		if !now.After(j.misfireGrace.Add(last)) {
+			fire = 1
+		}
+	}
+	if fire > len(missed) {
+		fire = len(missed)
+	}
+
+	skipped := missed[:len(missed)-fire]
+	for _, skippedAt := range skipped {
+		stat := NewJobStat(j.Id)
+		stat.RanAt = skippedAt
+		stat.Skipped = true
+		stat.SkipReason = fmt.Sprintf("misfire policy %s", j.MisfirePolicy)
+		j.Stats = append(j.Stats, stat)
+	}
+	if fire == 0 {
+		// The next run is computed from the last skipped one, as if it ran on time.
+		j.Metadata.LastAttemptedRun = skipped[len(skipped)-1]
+		j.Metadata.LastScheduledRun = skipped[len(skipped)-1].Add(-j.jitter)
+	}
+	j.misfires = fire
+	Logger.Infof("Job %s:%s missed %d runs, firing %d of them.", j.Name, j.Id, len(missed), fire)
+}
+
+// missedRuns returns the latest run times from the last run until now,
+// within the job's number of times to repeat and end,
+// and the number of earlier ones dropped to return at most maxMissedRuns.
+func (j *Job) missedRuns(now time.Time) (missed []time.Time, dropped int) {
+	runAt := j.scheduleTime
+	if !j.Metadata.LastAttemptedRun.IsZero() {
+		runAt = j.nextRunAfter(j.lastScheduledRun())
+	}
+	for count := 0; runAt.Add(j.jitter).Before(now) && count < maxMissedRunsScanned; count++ {
+		if j.hasFixedRepetitions() && j.ranRuns()+count > int(j.timesToRepeat) {
+			break
+		}
+		if !j.endTime.IsZero() && runAt.After(j.endTime) {
+			break
+		}
+		if missed = append(missed, runAt.Add(j.jitter)); len(missed) > maxMissedRuns {
+			missed = missed[1:]
+			dropped++
+		}
+		next := j.nextRunAfter(runAt)
+		if !next.After(runAt) {
+			break
+		}
+		runAt = next
+	}
+	return missed, dropped
+}
@@ -0,0 +1,94 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMisfirePolicy(t *testing.T) {
+	now := time.Date(2021, time.January, 1, 12, 30, 0, 0, time.UTC)
+	lastRun := time.Date(2021, time.January, 1, 7, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		policy   types.MisfirePolicy
+		limit    uint
+		grace    string
+		skipped  int
+		misfires int
+		wait     time.Duration
+	}{
+		// Missed runs from 08:00 to 12:00.
+		{types.MisfireFireOnce, 0, "", 4, 1, 0},
+		{types.MisfireFireAll, 0, "", 0, 5, 0},
+		{types.MisfireFireAll, 2, "", 3, 2, 0},
+		{types.MisfireSkip, 0, "", 5, 0, 30 * time.Minute},
+		{types.MisfireGrace, 0, "PT30M", 4, 1, 0},
+		{types.MisfireGrace, 0, "PT29M", 5, 0, 30 * time.Minute},
+	} {
+		j := &Job{Job: &types.Job{
+			Schedule:      "R/2021-01-01T07:00:00Z/PT1H",
+			MisfirePolicy: c.policy,
+			MisfireLimit:  c.limit,
+			MisfireGrace:  c.grace,
+			Metadata:      types.Metadata{LastAttemptedRun: lastRun},
+		}}
+		j.clk.SetClock(clock.NewMockClock(now))
+		assert.NoError(t, j.InitDelayDuration(false))
+		j.applyMisfirePolicy()
+
+		name := string(c.policy) + " " + c.grace
+		assert.Len(t, j.Stats, c.skipped, name)
+		for i, stat := range j.Stats {
+			assert.True(t, stat.Skipped, name)
+			assert.Equal(t, lastRun.Add(time.Duration(i+1)*time.Hour), stat.RanAt, name)
+		}
+		assert.Equal(t, c.misfires, j.misfires, name)
+		assert.Equal(t, c.wait, j.GetWaitDuration(), name)
+	}
+}
+
+func TestMisfirePolicyRepetitions(t *testing.T) {
+	now := time.Date(2021, time.January, 1, 12, 30, 0, 0, time.UTC)
+
+	// The first run at 07:00 and 2 repetitions were missed, out of 3 repetitions.
+	j := &Job{Job: &types.Job{
+		Schedule:      "R3/2021-01-01T07:00:00Z/PT1H",
+		ScheduleEnd:   time.Date(2021, time.January, 1, 9, 0, 0, 0, time.UTC),
+		MisfirePolicy: types.MisfireSkip,
+	}}
+	j.clk.SetClock(clock.NewMockClock(now))
+	assert.NoError(t, j.InitDelayDuration(false))
+	j.applyMisfirePolicy()
+	assert.Len(t, j.Stats, 3)
+	assert.False(t, j.ShouldStartWaiting())
+
+	j = &Job{Job: &types.Job{Schedule: "R/2021-01-01T07:00:00Z/PT1H", MisfirePolicy: "later"}}
+	assert.Error(t, j.InitDelayDuration(false))
+	j = &Job{Job: &types.Job{Schedule: "R/2021-01-01T07:00:00Z/PT1H", MisfirePolicy: types.MisfireGrace}}
+	assert.Error(t, j.InitDelayDuration(false))
+}
+
+func TestCacheStartAppliesMisfirePolicy(t *testing.T) {
+	now := time.Date(2021, time.January, 1, 12, 30, 0, 0, time.UTC)
+	clk := clock.NewMockClock(now)
+
+	j := GetMockJob()
+	j.Id = "misfire-job"
+	j.Schedule = "R/2021-01-01T07:00:00Z/PT1H"
+	j.MisfirePolicy = types.MisfireSkip
+	j.Metadata.LastAttemptedRun = time.Date(2021, time.January, 1, 7, 0, 0, 0, time.UTC)
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.InitDelayDuration(false))
+
+	cache := NewLockFreeJobCache(&MockDBGetAll{response: []*Job{j}})
+	cache.Start(pool, time.Hour, 0)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 5)
+	assert.Equal(t, time.Date(2021, time.January, 1, 13, 0, 0, 0, time.UTC), j.NextRunAt)
+}
@@ -0,0 +1,59 @@
+package job
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// DefaultOutputLimit is the number of bytes kept of each output of a run
+// by default, see types.Job.OutputLimit.
+const DefaultOutputLimit = 64 * 1024
+
+// outputBuffer keeps the first limit bytes written to it, or all of them if
+// limit is negative, and counts the dropped ones.
+type outputBuffer struct {
+	limit   int
+	buf     bytes.Buffer
+	dropped int64
+}
+
+func newOutputBuffer(limit int) *outputBuffer {
+	if limit == 0 {
+		limit = DefaultOutputLimit
+	}
+	return &outputBuffer{limit: limit}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if b.limit >= 0 {
+		if room := b.limit - b.buf.Len(); room < len(p) {
+			if room < 0 {
+				room = 0
+			}
+			b.dropped += int64(len(p) - room)
+			p = p[:room]
+		}
+	}
+	b.buf.Write(p)
+	return n, nil
+}
+
+// String returns the bytes kept, without a rune cut by the limit.
+func (b *outputBuffer) String() string {
+	out := b.buf.Bytes()
+	if b.Truncated() {
+		for i := 0; i < utf8.UTFMax && len(out) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(out); r != utf8.RuneError || size != 1 {
+				break
+			}
+			out = out[:len(out)-1]
+		}
+	}
+	return string(out)
+}
+
+// Truncated returns whether bytes beyond the limit were dropped.
+func (b *outputBuffer) Truncated() bool {
+	return b.dropped > 0
+}
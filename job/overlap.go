@@ -0,0 +1,149 @@
+package job
+
+import (
+	"errors"
+	"time"
+
+	"github.com/lovego/kala/types"
+)
+
+var (
+	ErrInvalidOverlapPolicy = errors.New("Invalid overlap policy, must be skip, queue or replace")
+
+	// How often a queued or replacing run checks whether the job is still running.
+	overlapPollInterval = time.Second
+)
+
+func validateOverlapPolicy(policy types.OverlapPolicy) error {
+	switch policy {
+	case "", types.OverlapSkip, types.OverlapQueue, types.OverlapReplace:
+		return nil
+	}
+	return ErrInvalidOverlapPolicy
+}
+
+// applyOverlapPolicy handles a run fired while the job already runs as many times as it may,
+// according to its OverlapPolicy. meta is the metadata of the fired run, and fired its runner.
+// The run queued or replacing the previous ones keeps its parameters and scheduled time.
+func (j *Job) applyOverlapPolicy(cache JobCache, fired *JobRunner, meta types.Metadata) {
+	j.lock.RLock()
+	policy := j.OverlapPolicy
+	j.lock.RUnlock()
+
+	reason := "overlap: job is running"
+	switch policy {
+	case types.OverlapQueue:
+		if j.queueRun() {
+			Logger.Infof("Job %s:%s is running, its run is queued.", j.Name, j.Id)
+			go j.runAfterRunning(cache, fired, policy)
+			return
+		}
+		reason = "overlap: a run is already queued"
+	case types.OverlapReplace:
+		if fired.overlap == types.OverlapReplace {
+			// Another run took the place of the cancelled ones first.
+			break
+		}
+		err := j.Cancel()
+		if err == nil || err == ErrJobNotRunning {
+			Logger.Infof("Job %s:%s is running, its previous runs are cancelled.", j.Name, j.Id)
+			// The nodes running the job release their leases once they abort their runs.
+			go j.runAfterRunning(cache, fired, policy)
+			return
+		}
+		Logger.Errorf("Job %s:%s error cancelling its previous runs: %s", j.Name, j.Id, err)
+	default:
+		policy = types.OverlapSkip
+	}
+	j.skipOverlap(cache, meta, policy, reason)
+}
+
+// queueRun marks a run of the job as queued, and returns false if one already is.
+func (j *Job) queueRun() bool {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	if j.queued {
+		return false
+	}
+	j.queued = true
+	return true
+}
+
+// runAfterRunning runs the queued or replacing run of the job once it isn't running anymore.
+// The run is dropped if the job is deleted or disabled meanwhile.
+func (j *Job) runAfterRunning(cache JobCache, fired *JobRunner, policy types.OverlapPolicy) {
+	dropped := false
+	for {
+		time.Sleep(overlapPollInterval)
+		if dropped = !j.mayRunLater(cache); dropped {
+			break
+		}
+		running, err := j.isRunning()
+		if err != nil {
+			Logger.Errorf("Job %s:%s error checking whether it's running: %s", j.Name, j.Id, err)
+			continue
+		}
+		if !running {
+			break
+		}
+	}
+	if policy == types.OverlapQueue {
+		j.runLock.Lock()
+		j.queued = false
+		j.runLock.Unlock()
+	}
+	if dropped {
+		Logger.Infof("Job %s:%s is deleted or disabled, its %s run is dropped.", j.Name, j.Id, policy)
+		return
+	}
+	// The run point of the schedule fired, if any, was taken by this node already.
+	j.runWithOverlap(cache, &JobRunner{params: fired.params, overlap: policy, scheduledAt: fired.scheduledAt})
+}
+
+// mayRunLater reports whether a run waiting for the job may still run,
+// i.e. the job wasn't deleted or disabled meanwhile.
+func (j *Job) mayRunLater(cache JobCache) bool {
+	if _, err := cache.Get(j.Id); errors.Is(err, ErrJobDoesntExist) {
+		return false
+	}
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	return !j.Disabled && !j.Deleted
+}
+
+// skipOverlap records a run fired while the job was running as skipped.
+func (j *Job) skipOverlap(cache JobCache, meta types.Metadata, policy types.OverlapPolicy, reason string) {
+	Logger.Infof("Job %s:%s skipped by %s.", j.Name, j.Id, reason)
+	stat := NewJobStat(j.Id)
+	stat.Skipped = true
+	stat.SkipReason = reason
+	stat.Overlap = policy
+
+	// The run on this node records the stat, as it holds the lock of the job until it finishes,
+	// and schedules the next run.
+	j.runLock.Lock()
+	if len(j.cancelRuns) > 0 {
+		j.overlapStats = append(j.overlapStats, stat)
+		j.runLock.Unlock()
+		return
+	}
+	j.runLock.Unlock()
+	// The next run is computed from the skipped one, as the job runs on another node.
+	j.finishRun(cache, meta, stat)
+}
+
+// takeOverlapStats returns the stats of the runs skipped while the job ran on this node.
+func (j *Job) takeOverlapStats() []*types.JobStat {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	stats := j.overlapStats
+	j.overlapStats = nil
+	return stats
+}
+
+// runningHere reports whether the job runs on this node.
+func (j *Job) runningHere() bool {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	return len(j.cancelRuns) > 0
+}
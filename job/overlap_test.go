@@ -0,0 +1,206 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+// startOverlapped runs j in the background with params, and waits for it to run.
+func startOverlapped(t *testing.T, cache JobCache, j *Job, params map[string]string) chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		j.RunWithParams(cache, params)
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if j.runningHere() {
+			return done
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Job didn't start")
+		}
+	}
+}
+
+// waitStats waits for j to have n stats, and returns them.
+func waitStats(t *testing.T, j *Job, n int) []*types.JobStat {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		j.lock.RLock()
+		stats := append([]*types.JobStat{}, j.Stats...)
+		j.lock.RUnlock()
+		if len(stats) >= n {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Job has %d stats instead of %d", len(stats), n)
+		}
+	}
+}
+
+func newOverlapJob(t *testing.T, cache JobCache, policy types.OverlapPolicy) *Job {
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = "sleep {{ .Params.seconds }}"
+	j.TemplateDelimiters = "{{ }}"
+	j.OverlapPolicy = policy
+	assert.NoError(t, j.Init(cache))
+	return j
+}
+
+func TestOverlapSkip(t *testing.T) {
+	cache := NewMockCache()
+	j := newOverlapJob(t, cache, "")
+	done := startOverlapped(t, cache, j, map[string]string{"seconds": "10"})
+
+	j.RunWithParams(cache, map[string]string{"seconds": "0"})
+	assert.NoError(t, j.Cancel())
+	<-done
+	stats := waitStats(t, j, 2)
+	assert.True(t, stats[0].Cancelled)
+	assert.Empty(t, stats[0].Overlap)
+	assert.True(t, stats[1].Skipped)
+	assert.Equal(t, "overlap: job is running", stats[1].SkipReason)
+	assert.Equal(t, types.OverlapSkip, stats[1].Overlap)
+}
+
+func TestOverlapQueue(t *testing.T) {
+	defer func(d time.Duration) { overlapPollInterval = d }(overlapPollInterval)
+	overlapPollInterval = 10 * time.Millisecond
+
+	cache := NewMockCache()
+	j := newOverlapJob(t, cache, types.OverlapQueue)
+	done := startOverlapped(t, cache, j, map[string]string{"seconds": "0.3"})
+
+	j.RunWithParams(cache, map[string]string{"seconds": "0"})
+	j.RunWithParams(cache, map[string]string{"seconds": "0"})
+	<-done
+	stats := waitStats(t, j, 3)
+	assert.True(t, stats[0].Success)
+	assert.Empty(t, stats[0].Overlap)
+	assert.True(t, stats[1].Skipped)
+	assert.Equal(t, "overlap: a run is already queued", stats[1].SkipReason)
+	assert.Equal(t, types.OverlapQueue, stats[1].Overlap)
+	assert.True(t, stats[2].Success)
+	assert.Equal(t, types.OverlapQueue, stats[2].Overlap)
+	assert.True(t, stats[2].RanAt.After(stats[0].RanAt))
+}
+
+func TestOverlapQueueDropped(t *testing.T) {
+	defer func(d time.Duration) { overlapPollInterval = d }(overlapPollInterval)
+	overlapPollInterval = 10 * time.Millisecond
+
+	cache := NewMockCache()
+	j := newOverlapJob(t, cache, types.OverlapQueue)
+	// The job runs on another node, which doesn't release it.
+	lease := startMockJob(t, j)
+	defer j.finish(lease)
+
+	queued := func() bool {
+		j.runLock.Lock()
+		defer j.runLock.Unlock()
+		return j.queued
+	}
+	j.RunWithParams(cache, map[string]string{"seconds": "0"})
+	assert.True(t, queued())
+	assert.NoError(t, j.Disable(cache))
+	for deadline := time.Now().Add(5 * time.Second); queued(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Queued run wasn't dropped")
+		}
+	}
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Empty(t, j.Stats)
+}
+
+func TestOverlapReplace(t *testing.T) {
+	defer func(d time.Duration) { overlapPollInterval = d }(overlapPollInterval)
+	overlapPollInterval = 10 * time.Millisecond
+
+	cache := NewMockCache()
+	j := newOverlapJob(t, cache, types.OverlapReplace)
+	done := startOverlapped(t, cache, j, map[string]string{"seconds": "10"})
+
+	j.RunWithParams(cache, map[string]string{"seconds": "0"})
+	<-done
+	stats := waitStats(t, j, 2)
+	var cancelled, replacing *types.JobStat
+	for _, stat := range stats {
+		if stat.Cancelled {
+			cancelled = stat
+		} else {
+			replacing = stat
+		}
+	}
+	if assert.NotNil(t, cancelled) && assert.NotNil(t, replacing) {
+		assert.Empty(t, cancelled.Overlap)
+		assert.True(t, replacing.Success)
+		assert.Equal(t, types.OverlapReplace, replacing.Overlap)
+	}
+}
+
+func TestOverlapSameOccurrence(t *testing.T) {
+	defer func(d time.Duration) { overlapPollInterval = d }(overlapPollInterval)
+	overlapPollInterval = 10 * time.Millisecond
+
+	cache := NewMockCache()
+	j := newOverlapJob(t, cache, types.OverlapQueue)
+	scheduledAt := time.Now().Truncate(time.Millisecond)
+	fire := func() {
+		j.runWithOverlap(cache, &JobRunner{
+			params: map[string]string{"seconds": "0.3"}, scheduledAt: scheduledAt, occurrence: scheduledAt,
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		fire()
+		close(done)
+	}()
+	for deadline := time.Now().Add(5 * time.Second); !j.runningHere(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Job didn't start")
+		}
+	}
+
+	// The run point fired by another node too is neither queued nor skipped.
+	fire()
+	<-done
+	// A queued run would have run by now.
+	time.Sleep(500 * time.Millisecond)
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	if assert.Len(t, j.Stats, 1) {
+		assert.True(t, j.Stats[0].Success)
+		assert.Empty(t, j.Stats[0].Overlap)
+	}
+}
+
+func TestOverlapRunsWaitOnce(t *testing.T) {
+	now := time.Date(2021, time.January, 4, 10, 0, 0, 0, time.UTC)
+	clk := clock.NewMockClock(now)
+	cache := NewMockCache()
+
+	j := GetMockRecurringJobWithSchedule(now.Add(5*time.Second), "PT1H")
+	j.clk.SetClock(clk)
+	assert.NoError(t, j.Init(cache))
+
+	// A queued run and the run it waited for both wait for the next run,
+	// with a single timer.
+	j.lock.RLock()
+	timer := j.jobTimer
+	j.lock.RUnlock()
+	j.StartWaiting(cache, false)
+	assert.False(t, timer.Stop())
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.True(t, j.jobTimer.Stop())
+}
+
+func TestOverlapPolicyValidation(t *testing.T) {
+	j := GetMockJob()
+	j.OverlapPolicy = "wait"
+	assert.Equal(t, ErrInvalidOverlapPolicy, j.Init(NewMockCache()))
+}
@@ -0,0 +1,64 @@
+package job
+
+import (
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+)
+
+const (
+	DefaultPreviewCount = 10
+	MaxPreviewCount     = 1000
+)
+
+// PreviewSchedule returns the next run times of a schedule, computed the same way
+// as those of a job created with it now, but without creating a job.
+func PreviewSchedule(preview *types.SchedulePreview) ([]time.Time, error) {
+	j := &Job{Job: &types.Job{
+		Schedule:                  preview.Schedule,
+		Cron:                      preview.Cron,
+		TimeZone:                  preview.TimeZone,
+		ScheduleEnd:               preview.ScheduleEnd,
+		Epsilon:                   preview.Epsilon,
+		ResumeAtNextScheduledTime: preview.ResumeAtNextScheduledTime,
+	}}
+
+	count := preview.Count
+	if count <= 0 {
+		count = DefaultPreviewCount
+	} else if count > MaxPreviewCount {
+		count = MaxPreviewCount
+	}
+	return j.previewRunTimes(count)
+}
+
+// previewRunTimes simulates up to n runs of the job on a mock clock starting now.
+func (j *Job) previewRunTimes(n int) ([]time.Time, error) {
+	now := j.clk.Time().Now()
+	// A start datetime in the past is allowed, so that the runs of a job
+	// resuming at its next scheduled time can be previewed.
+	if err := j.InitDelayDuration(false); err != nil {
+		return nil, err
+	}
+	clk := clock.NewMockClock(now)
+	j.clk.SetClock(clk)
+
+	var runTimes []time.Time
+	for len(runTimes) < n {
+		if wait := j.GetWaitDuration(); wait > 0 {
+			clk.AddTime(wait)
+		}
+		ranAt := clk.Now()
+		runTimes = append(runTimes, ranAt.In(j.scheduleLocation(ranAt.Location())))
+		j.Metadata.LastAttemptedRun = ranAt
+		j.Metadata.LastScheduledRun = ranAt
+		j.Stats = append(j.Stats, &types.JobStat{RanAt: ranAt})
+		if !j.ShouldStartWaiting() {
+			break
+		}
+		// A run takes some time, so the next run is computed a bit after it.
+		clk.AddTime(time.Nanosecond)
+	}
+	return runTimes, nil
+}
@@ -0,0 +1,46 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/mixer/clock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewRunTimes(t *testing.T) {
+	now := time.Date(2021, time.January, 1, 12, 0, 0, 0, time.UTC)
+	day := func(d int, hour int) time.Time {
+		return time.Date(2021, time.January, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	j := &Job{Job: &types.Job{Schedule: "R2/2021-01-02T09:00:00Z/P1D"}}
+	j.clk.SetClock(clock.NewMockClock(now))
+	runTimes, err := j.previewRunTimes(10)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{day(2, 9), day(3, 9), day(4, 9)}, runTimes)
+
+	// A missed first run waits one interval from now...
+	j = &Job{Job: &types.Job{Schedule: "R/2020-12-30T09:00:00Z/P1D"}}
+	j.clk.SetClock(clock.NewMockClock(now))
+	runTimes, err = j.previewRunTimes(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{day(2, 12), day(3, 12), day(4, 12)}, runTimes)
+
+	// ...unless the job resumes at its next scheduled time.
+	j = &Job{Job: &types.Job{Schedule: "R/2020-12-30T09:00:00Z/P1D", ResumeAtNextScheduledTime: true}}
+	j.clk.SetClock(clock.NewMockClock(now))
+	runTimes, err = j.previewRunTimes(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{day(2, 9), day(3, 9), day(4, 9)}, runTimes)
+
+	j = &Job{Job: &types.Job{Cron: "0 9 * * *", TimeZone: "UTC", ScheduleEnd: day(3, 12)}}
+	j.clk.SetClock(clock.NewMockClock(now))
+	runTimes, err = j.previewRunTimes(10)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{day(2, 9), day(3, 9)}, runTimes)
+
+	_, err = PreviewSchedule(&types.SchedulePreview{Schedule: "R/2021-01-02T09:00:00Z"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,9 @@
+//go:build !go1.20
+// +build !go1.20
+
+package job
+
+import "os/exec"
+
+// setWaitDelay does nothing, exec.Cmd.WaitDelay requires go 1.20.
+func setWaitDelay(cmd *exec.Cmd) {}
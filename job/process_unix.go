@@ -0,0 +1,41 @@
+//go:build !windows
+// +build !windows
+
+package job
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup runs the command in a new process group,
+// so that killProcessGroup also kills the processes it started.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// setCredential runs the command as the user uid and group gid,
+// those of Kala if nil.
+func setCredential(cmd *exec.Cmd, uid, gid *uint32) error {
+	credential := &syscall.Credential{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}
+	if uid != nil {
+		credential.Uid = *uid
+	}
+	if gid != nil {
+		credential.Gid = *gid
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Credential = credential
+	return nil
+}
+
+// killProcessGroup kills the started command and the processes of its group.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,12 @@
+//go:build go1.20
+// +build go1.20
+
+package job
+
+import "os/exec"
+
+// setWaitDelay closes the output of a killed command after killWaitDelay,
+// even if processes it started, which weren't killed with it, still hold it.
+func setWaitDelay(cmd *exec.Cmd) {
+	cmd.WaitDelay = killWaitDelay
+}
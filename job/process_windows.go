@@ -0,0 +1,25 @@
+//go:build windows
+// +build windows
+
+package job
+
+import (
+	"errors"
+	"os/exec"
+)
+
+var ErrCredentialUnsupported = errors.New("Running a job as another user is not supported on windows.")
+
+// setProcessGroup does nothing, process groups aren't supported on windows.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// setCredential fails, running as another user isn't supported on windows.
+func setCredential(cmd *exec.Cmd, uid, gid *uint32) error {
+	return ErrCredentialUnsupported
+}
+
+// killProcessGroup kills the started command, but not the processes it started,
+// which setWaitDelay keeps from holding its output.
+func killProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
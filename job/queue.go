@@ -0,0 +1,114 @@
+package job
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/garyburd/redigo/redis"
+	"github.com/lovego/kala/types"
+)
+
+// The runs rejected by the concurrency of their group or of the cluster wait in the queue
+// of their group, a Redis sorted set of their leases shared by all nodes, and start
+// in its order once slots are free. A waiting run is removed from the queue if its node
+// doesn't check for a slot for leaseTTL, e.g. if it crashed.
+
+const (
+	// Range of the Priority of jobs.
+	minPriority, maxPriority = -100, 100
+	// Factor of the priority in the score of a waiting run, above its sequence number.
+	priorityFactor = 1e13
+)
+
+var (
+	ErrInvalidPriority = fmt.Errorf("Invalid priority, must be from %d to %d", minPriority, maxPriority)
+	ErrInvalidQueue    = errors.New("Invalid queue order, must be fifo or priority")
+
+	// How often a waiting run checks for a free slot.
+	queuePollInterval = time.Second
+
+	// dequeueScript removes a waiting run from the queue of its group.
+	dequeueScript = redis.NewScript(leaseKeysCount, `
+redis.call('ZREM', KEYS[4], ARGV[1])
+redis.call('ZREM', KEYS[5], ARGV[1])
+redis.call('HDEL', KEYS[6], ARGV[1])
+`)
+)
+
+func validatePriority(priority int) error {
+	if priority < minPriority || priority > maxPriority {
+		return ErrInvalidPriority
+	}
+	return nil
+}
+
+func validateQueueOrder(order types.QueueOrder) error {
+	switch order {
+	case "", types.QueueFifo, types.QueuePriority:
+		return nil
+	}
+	return ErrInvalidQueue
+}
+
+// queuePriority returns the score of the priority of a run of the job in the queue of
+// its group with the settings g, nil if it has none. Lower scores start first.
+func (j *Job) queuePriority(g *types.Group) int64 {
+	if g != nil && g.QueueOrder == types.QueuePriority {
+		return -int64(j.Priority) * priorityFactor
+	}
+	return 0
+}
+
+// waitForSlot runs a run rejected by the concurrency of the job's group or of the cluster
+// once a slot is free for it. The run is dropped if the job is deleted or disabled meanwhile,
+// and tries again after an error starting it, e.g. of Redis.
+func (j *Job) waitForSlot(cache JobCache, jobRunner *JobRunner) {
+	Logger.Infof("Job %s:%s is waiting for a slot.", j.Name, j.Id)
+	for {
+		time.Sleep(queuePollInterval)
+		if j.run(cache, jobRunner) != ErrBeyoundConcurrency {
+			break
+		}
+	}
+	// The run left the queue if it started, not if it was dropped.
+	if err := j.dequeue(jobRunner.lease); err != nil {
+		Logger.Errorf("Job %s:%s error leaving the queue: %s", j.Name, j.Id, err)
+	}
+}
+
+// dequeue removes a waiting run of the job from the queue of its group.
+func (j *Job) dequeue(lease string) error {
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := dequeueScript.Do(conn, leaseKeys(j.GroupName, lease)...)
+	return err
+}
+
+// queueStats returns the number of runs waiting in the queue of a group,
+// and the time the one waiting the longest has been waiting.
+func queueStats(conn redis.Conn, group string) (int, time.Duration, error) {
+	now := nowMillis()
+	leases, err := redis.Strings(conn.Do(
+		"ZRANGEBYSCORE", waitingExpiryKeyPrefix+group, fmt.Sprintf("(%d", now), "+inf",
+	))
+	if err != nil || len(leases) == 0 {
+		return 0, 0, err
+	}
+	since, err := redis.Values(conn.Do("HMGET", redis.Args{}.Add(waitingSinceKeyPrefix+group).AddFlat(leases)...))
+	if err != nil {
+		return 0, 0, err
+	}
+	var maxWait time.Duration
+	for _, v := range since {
+		// A run leaving the queue meanwhile has no time anymore.
+		ms, err := redis.Int64(v, nil)
+		if err != nil {
+			continue
+		}
+		if wait := time.Duration(now-ms) * time.Millisecond; wait > maxWait {
+			maxWait = wait
+		}
+	}
+	return len(leases), maxWait, nil
+}
@@ -0,0 +1,171 @@
+package job
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueuePriority(t *testing.T) {
+	defer func(d time.Duration) { queuePollInterval = d }(queuePollInterval)
+	queuePollInterval = 10 * time.Millisecond
+
+	group := fmt.Sprintf("queue-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 1, QueueOrder: types.QueuePriority}))
+	defer DeleteGroup(group)
+
+	cache := NewMockCache()
+	newJob := func(command string, priority int) *Job {
+		j := GetMockJobWithGenericSchedule(time.Now())
+		j.GroupName = group
+		j.Command = command
+		j.Priority = priority
+		assert.NoError(t, j.Init(cache))
+		return j
+	}
+	blocker := newJob("sleep 0.3", 0)
+	low, high := newJob("true", 0), newJob("true", 10)
+
+	done := startOverlapped(t, cache, blocker, nil)
+	low.Run(cache)
+	high.Run(cache)
+	_, groups, err := concurrencyStats([]string{group})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, groups[group].Waiting)
+
+	<-done
+	lowStat, highStat := waitStats(t, low, 1)[0], waitStats(t, high, 1)[0]
+	assert.True(t, lowStat.Success)
+	assert.True(t, highStat.Success)
+	assert.True(t, highStat.RanAt.Before(lowStat.RanAt))
+	assert.NotEmpty(t, highStat.Waited)
+	assert.NotEmpty(t, lowStat.Waited)
+	assert.Empty(t, waitStats(t, blocker, 1)[0].Waited)
+
+	_, groups, err = concurrencyStats([]string{group})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, groups[group].Waiting)
+}
+
+func TestQueueDropped(t *testing.T) {
+	defer func(d time.Duration) { queuePollInterval = d }(queuePollInterval)
+	queuePollInterval = 10 * time.Millisecond
+
+	group := fmt.Sprintf("dropped-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 1}))
+	defer DeleteGroup(group)
+
+	cache := NewMockCache()
+	blocker := newRunningMockJob(group)
+	defer blocker.finish(startMockJob(t, blocker))
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.GroupName = group
+	assert.NoError(t, j.Init(cache))
+
+	j.Run(cache)
+	_, groups, err := concurrencyStats([]string{group})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, groups[group].Waiting)
+
+	// The run leaves the queue once the job is disabled, without running.
+	assert.NoError(t, j.Disable(cache))
+	for deadline := time.Now().Add(5 * time.Second); groups[group].Waiting > 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Waiting run wasn't dropped")
+		}
+		_, groups, err = concurrencyStats([]string{group})
+		assert.NoError(t, err)
+	}
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Empty(t, j.Stats)
+}
+
+func TestQueueRetried(t *testing.T) {
+	defer func(d time.Duration) { queuePollInterval = d }(queuePollInterval)
+	queuePollInterval = 10 * time.Millisecond
+
+	group := fmt.Sprintf("retried-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 1}))
+	defer DeleteGroup(group)
+
+	cache := NewMockCache()
+	blocker := newRunningMockJob(group)
+	lease := startMockJob(t, blocker)
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.GroupName = group
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	// The waiting run keeps waiting while it can't be started.
+	assert.NoError(t, blocker.finish(lease))
+	conn := pool.Get()
+	defer conn.Close()
+	_, err := conn.Do("SET", runningKey(group), "broken")
+	assert.NoError(t, err)
+	time.Sleep(10 * queuePollInterval)
+	j.lock.RLock()
+	assert.Empty(t, j.Stats)
+	j.lock.RUnlock()
+
+	_, err = conn.Do("DEL", runningKey(group))
+	assert.NoError(t, err)
+	assert.True(t, waitStats(t, j, 1)[0].Success)
+}
+
+func TestQueueFifo(t *testing.T) {
+	group := fmt.Sprintf("fifo-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 1}))
+	defer DeleteGroup(group)
+
+	j1, j2, j3 := newRunningMockJob(group), newRunningMockJob(group), newRunningMockJob(group)
+	j3.Priority = 10
+	lease1 := startMockJob(t, j1)
+	lease2, lease3 := j2.newLease(), j3.newLease()
+	assert.Equal(t, ErrBeyoundConcurrency, j2.start(lease2, time.Time{}))
+	assert.Equal(t, ErrBeyoundConcurrency, j3.start(lease3, time.Time{}))
+
+	assert.NoError(t, j1.finish(lease1))
+	// j3 waits behind j2, queued first, the group not ordering by priority.
+	assert.Equal(t, ErrBeyoundConcurrency, j3.start(lease3, time.Time{}))
+	// A new run waits behind both.
+	assert.Equal(t, ErrBeyoundConcurrency, j1.start(lease1, time.Time{}))
+	assert.NoError(t, j1.dequeue(lease1))
+	assert.NoError(t, j2.start(lease2, time.Time{}))
+	assert.NoError(t, j2.finish(lease2))
+	assert.NoError(t, j3.start(lease3, time.Time{}))
+	assert.NoError(t, j3.finish(lease3))
+}
+
+func TestQueueSameOccurrence(t *testing.T) {
+	group := fmt.Sprintf("occurrence-%d", time.Now().UnixNano())
+	assert.NoError(t, SetGroup(&types.Group{Name: group, Concurrency: 1}))
+	defer DeleteGroup(group)
+
+	blocker, j := newRunningMockJob(group), newRunningMockJob(group)
+	blockerLease := startMockJob(t, blocker)
+	scheduledAt := time.Now()
+	lease := j.newLease()
+	assert.Equal(t, ErrBeyoundConcurrency, j.start(lease, scheduledAt))
+	// Another node firing the same run point doesn't queue it again.
+	assert.Equal(t, ErrOccurrenceStarted, j.start(j.newLease(), scheduledAt))
+	_, groups, err := concurrencyStats([]string{group})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, groups[group].Waiting)
+
+	// The queued run still takes its turn.
+	assert.NoError(t, blocker.finish(blockerLease))
+	assert.NoError(t, j.start(lease, scheduledAt))
+	assert.NoError(t, j.finish(lease))
+	assert.Equal(t, ErrOccurrenceStarted, j.start(j.newLease(), scheduledAt))
+}
+
+func TestQueueValidation(t *testing.T) {
+	assert.Equal(t, ErrInvalidQueue, SetGroup(&types.Group{Name: "queue", QueueOrder: "lifo"}))
+	j := GetMockJob()
+	j.Priority = 101
+	assert.Equal(t, ErrInvalidPriority, j.Init(NewMockCache()))
+}
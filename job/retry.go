@@ -0,0 +1,85 @@
+package job
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+// DefaultRetryMultiplier is the factor of exponential retry delays by default.
+const DefaultRetryMultiplier = 2
+
+func validateRetryPolicy(p *types.RetryPolicy) error {
+	switch p.Backoff {
+	case "":
+		return nil
+	case types.RetryFixed, types.RetryExponential:
+	default:
+		return fmt.Errorf("Invalid retry backoff %s", p.Backoff)
+	}
+	if p.Delay == "" {
+		return fmt.Errorf("Retry backoff %s needs a delay", p.Backoff)
+	}
+	for _, d := range []string{p.Delay, p.MaxDelay} {
+		if d == "" {
+			continue
+		}
+		if _, err := iso8601.FromString(d); err != nil {
+			return err
+		}
+	}
+	if p.Multiplier < 0 {
+		return fmt.Errorf("Invalid retry multiplier %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("Invalid retry jitter %v, it should be from 0 to 1", p.Jitter)
+	}
+	return nil
+}
+
+// retryDelay returns the delay before the retry number retry (1 for the first one) of an attempt.
+func retryDelay(p *types.RetryPolicy, retry uint, now time.Time) time.Duration {
+	if p.Backoff == "" || retry == 0 {
+		return 0
+	}
+	delay, err := durationRelativeTo(p.Delay, now)
+	if err != nil {
+		Logger.Errorf("Error converting retry delay to iso8601.Duration: %s", err)
+		return 0
+	}
+	if p.Backoff == types.RetryExponential {
+		multiplier := p.Multiplier
+		if multiplier == 0 {
+			multiplier = DefaultRetryMultiplier
+		}
+		if exponential := float64(delay) * math.Pow(multiplier, float64(retry-1)); exponential >= math.MaxInt64 {
+			delay = math.MaxInt64
+		} else {
+			delay = time.Duration(exponential)
+		}
+	}
+	if p.MaxDelay != "" {
+		maxDelay, err := durationRelativeTo(p.MaxDelay, now)
+		if err != nil {
+			Logger.Errorf("Error converting retry max delay to iso8601.Duration: %s", err)
+		} else if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay)) //nolint:gosec
+	}
+	return delay
+}
+
+func durationRelativeTo(s string, now time.Time) (time.Duration, error) {
+	d, err := iso8601.FromString(s)
+	if err != nil {
+		return 0, err
+	}
+	return d.RelativeTo(now), nil
+}
@@ -0,0 +1,154 @@
+package job
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Now()
+	delays := func(p types.RetryPolicy) (delays []time.Duration) {
+		assert.NoError(t, validateRetryPolicy(&p))
+		for retry := uint(1); retry <= 5; retry++ {
+			delays = append(delays, retryDelay(&p, retry, now))
+		}
+		return delays
+	}
+
+	assert.Equal(t, []time.Duration{0, 0, 0, 0, 0}, delays(types.RetryPolicy{}))
+	assert.Equal(t,
+		[]time.Duration{10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+		delays(types.RetryPolicy{Backoff: types.RetryFixed, Delay: "PT10S"}),
+	)
+	assert.Equal(t,
+		[]time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second},
+		delays(types.RetryPolicy{Backoff: types.RetryExponential, Delay: "PT1S", MaxDelay: "PT5S"}),
+	)
+	assert.Equal(t,
+		[]time.Duration{time.Second, 3 * time.Second, 9 * time.Second, 27 * time.Second, 81 * time.Second},
+		delays(types.RetryPolicy{Backoff: types.RetryExponential, Delay: "PT1S", Multiplier: 3}),
+	)
+	for _, delay := range delays(types.RetryPolicy{Backoff: types.RetryFixed, Delay: "PT10S", Jitter: 0.5}) {
+		assert.True(t, delay > 5*time.Second && delay <= 10*time.Second, delay.String())
+	}
+	p := types.RetryPolicy{Backoff: types.RetryExponential, Delay: "P1Y"}
+	assert.True(t, retryDelay(&p, 100, now) > 0)
+
+	for _, invalid := range []types.RetryPolicy{
+		{Backoff: "linear", Delay: "PT1S"},
+		{Backoff: types.RetryFixed},
+		{Backoff: types.RetryFixed, Delay: "1s"},
+		{Backoff: types.RetryExponential, Delay: "PT1S", MaxDelay: "1m"},
+		{Backoff: types.RetryExponential, Delay: "PT1S", Multiplier: -1},
+		{Backoff: types.RetryFixed, Delay: "PT1S", Jitter: 2},
+	} {
+		assert.Error(t, validateRetryPolicy(&invalid), invalid.Backoff)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = "false"
+	j.Retries = 2
+	j.RetryPolicy = types.RetryPolicy{Backoff: types.RetryFixed, Delay: "PT1S"}
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 1)
+	attempts := j.Stats[0].Attempts
+	assert.Len(t, attempts, 3)
+	for i := 1; i < len(attempts); i++ {
+		assert.True(t, attempts[i].RanAt.Sub(attempts[i-1].RanAt) >= time.Second)
+		assert.Equal(t, "exit status 1", attempts[i].Error)
+	}
+	assert.Equal(t, uint(2), j.Stats[0].NumberOfRetries)
+}
+
+func TestRetryBackoffRespectsEpsilon(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = "false"
+	j.Retries = 2
+	j.Epsilon = "PT1S"
+	j.RetryPolicy = types.RetryPolicy{Backoff: types.RetryFixed, Delay: "PT2S"}
+	assert.NoError(t, j.Init(cache))
+	j.lock.Lock()
+	j.NextRunAt = time.Now()
+	j.lock.Unlock()
+
+	start := time.Now()
+	j.Run(cache)
+	assert.True(t, time.Since(start) < time.Second)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats[0].Attempts, 1)
+	assert.Equal(t, uint(0), j.Stats[0].NumberOfRetries)
+}
+
+func TestRetryClassification(t *testing.T) {
+	attempts := func(j *Job) int {
+		cache := NewMockCache()
+		j.Retries = 2
+		assert.NoError(t, j.Init(cache))
+		j.Run(cache)
+
+		j.lock.RLock()
+		defer j.lock.RUnlock()
+		return len(j.Stats[0].Attempts)
+	}
+
+	t.Run("exit codes", func(t *testing.T) {
+		j := GetMockJobWithGenericSchedule(time.Now())
+		j.Command = "sh -c 'exit 2'"
+		j.LocalProperties.RetryableExitCodes = []int{75}
+		assert.Equal(t, 1, attempts(j))
+
+		j = GetMockJobWithGenericSchedule(time.Now())
+		j.Command = "sh -c 'exit 75'"
+		j.LocalProperties.RetryableExitCodes = []int{75}
+		assert.Equal(t, 3, attempts(j))
+	})
+
+	t.Run("response codes", func(t *testing.T) {
+		status := http.StatusBadRequest
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		defer srv.Close()
+		remote := func() *Job {
+			j := GetMockJobWithGenericSchedule(time.Now())
+			j.JobType = types.RemoteJob
+			j.RemoteProperties.Url = srv.URL
+			j.RemoteProperties.RetryableResponseCodes = []int{http.StatusServiceUnavailable}
+			return j
+		}
+		assert.Equal(t, 1, attempts(remote()))
+		status = http.StatusServiceUnavailable
+		assert.Equal(t, 3, attempts(remote()))
+	})
+
+	t.Run("network errors", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		retry := false
+		j := GetMockJobWithGenericSchedule(time.Now())
+		j.JobType = types.RemoteJob
+		j.RemoteProperties.Url = srv.URL
+		j.RemoteProperties.RetryNetworkErrors = &retry
+		assert.Equal(t, 1, attempts(j))
+
+		j = GetMockJobWithGenericSchedule(time.Now())
+		j.JobType = types.RemoteJob
+		j.RemoteProperties.Url = srv.URL
+		assert.Equal(t, 3, attempts(j))
+	})
+}
@@ -0,0 +1,135 @@
+package job
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/lovego/kala/types"
+)
+
+// RunLogSize is the number of bytes of output of a running job kept in memory for its followers.
+var RunLogSize = 1024 * 1024
+
+// RunLog is the output of the running attempt of a job, the latest RunLogSize bytes
+// of which are kept for its followers.
+type RunLog struct {
+	lock    sync.Mutex
+	chunks  []types.LogChunk
+	size    int
+	next    int64
+	closed  bool
+	changed chan struct{}
+}
+
+func newRunLog() *RunLog {
+	return &RunLog{changed: make(chan struct{})}
+}
+
+// writer returns a writer appending to the log chunks of stream.
+func (l *RunLog) writer(stream string) io.Writer {
+	return runLogWriter{log: l, stream: stream}
+}
+
+type runLogWriter struct {
+	log    *RunLog
+	stream string
+}
+
+func (w runLogWriter) Write(p []byte) (int, error) {
+	w.log.append(w.stream, p)
+	return len(p), nil
+}
+
+func (l *RunLog) append(stream string, p []byte) {
+	if len(p) > RunLogSize {
+		p = p[len(p)-RunLogSize:]
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.chunks = append(l.chunks, types.LogChunk{Seq: l.next, Stream: stream, Data: string(p)})
+	l.next++
+	l.size += len(p)
+	for l.size > RunLogSize {
+		l.size -= len(l.chunks[0].Data)
+		l.chunks[0] = types.LogChunk{}
+		l.chunks = l.chunks[1:]
+	}
+	l.notify()
+}
+
+// close ends the log, at the end of the run.
+func (l *RunLog) close() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.closed = true
+	l.notify()
+}
+
+// notify wakes the followers up, l.lock must be held.
+func (l *RunLog) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Follow calls fn with the chunks of the log from the sequence number from, or from
+// the oldest one kept, as they are written, until the log ends or ctx is done.
+func (l *RunLog) Follow(ctx context.Context, from int64, fn func(types.LogChunk) error) error {
+	for {
+		l.lock.Lock()
+		var chunks []types.LogChunk
+		if len(l.chunks) > 0 {
+			if i := from - l.chunks[0].Seq; i < 0 {
+				chunks = l.chunks
+			} else if i < int64(len(l.chunks)) {
+				chunks = l.chunks[i:]
+			}
+			// Chunks are never modified once appended, only dropped.
+			chunks = append([]types.LogChunk{}, chunks...)
+		}
+		closed, changed := l.closed, l.changed
+		l.lock.Unlock()
+
+		for _, chunk := range chunks {
+			if err := fn(chunk); err != nil {
+				return err
+			}
+			from = chunk.Seq + 1
+		}
+		if closed {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// RunLog returns the output of the latest running attempt of the job,
+// or nil if the job isn't running on this node.
+func (j *Job) RunLog() *RunLog {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	return j.runLog
+}
+
+// startRunLog starts the output of a run for its followers,
+// until the returned function is called at the end of the run.
+func (j *Job) startRunLog() (*RunLog, func()) {
+	log := newRunLog()
+	j.runLock.Lock()
+	j.runLog = log
+	j.runLock.Unlock()
+
+	return log, func() {
+		j.runLock.Lock()
+		if j.runLog == log {
+			j.runLog = nil
+		}
+		j.runLock.Unlock()
+		log.close()
+	}
+}
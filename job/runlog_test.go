@@ -0,0 +1,77 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunLogFollow(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = `bash -c 'echo one; sleep 0.5; echo two >&2'`
+	assert.NoError(t, j.Init(cache))
+	assert.Nil(t, j.RunLog())
+
+	done := make(chan struct{})
+	go func() {
+		j.Run(cache)
+		close(done)
+	}()
+	var log *RunLog
+	for deadline := time.Now().Add(5 * time.Second); log == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Job didn't start")
+		}
+		log = j.RunLog()
+	}
+
+	var chunks []types.LogChunk
+	assert.NoError(t, log.Follow(context.Background(), 0, func(chunk types.LogChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}))
+	assert.Equal(t, []types.LogChunk{
+		{Seq: 0, Stream: "stdout", Data: "one\n"},
+		{Seq: 1, Stream: "stderr", Data: "two\n"},
+	}, chunks)
+	<-done
+	assert.Nil(t, j.RunLog())
+}
+
+func TestRunLogIsBounded(t *testing.T) {
+	defer func(size int) { RunLogSize = size }(RunLogSize)
+	RunLogSize = 10
+
+	log := newRunLog()
+	w := log.writer("stdout")
+	for _, s := range []string{"1234", "5678", "90ab", "0123456789abcdef"} {
+		_, _ = w.Write([]byte(s))
+	}
+	_, _ = w.Write([]byte("cd"))
+	log.close()
+
+	var chunks []types.LogChunk
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, log.Follow(ctx, 0, func(chunk types.LogChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}))
+	// Older chunks are dropped to keep at most 10 bytes.
+	assert.Equal(t, []types.LogChunk{{Seq: 4, Stream: "stdout", Data: "cd"}}, chunks)
+
+	chunks = nil
+	open := newRunLog()
+	_, _ = open.writer("stderr").Write([]byte("12"))
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, open.Follow(ctx, 1, func(chunk types.LogChunk) error {
+		chunks = append(chunks, chunk)
+		return nil
+	}))
+	assert.Empty(t, chunks)
+}
@@ -8,8 +8,12 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"os/exec"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
@@ -19,10 +23,31 @@ import (
 
 type JobRunner struct {
 	job              *Job
+	ctx              context.Context
+	log              *RunLog
+	storedLog        io.WriteCloser
 	meta             types.Metadata
 	numberOfAttempts uint
 	currentRetries   uint
 	currentStat      *types.JobStat
+
+	// Values of the secrets resolved by the run, see redact.
+	secrets     []string
+	secretsLock sync.Mutex
+
+	// Overlap policy applied to the run, if any.
+	overlap types.OverlapPolicy
+	// Lease of the run, and when it was queued for a slot, zero if it wasn't.
+	lease    string
+	queuedAt time.Time
+	// Run point of the schedule the run was fired for by the job's timer, which only
+	// one node runs, zero for a run started otherwise or already fired, see start.
+	occurrence time.Time
+
+	// Fields of the TemplateData of the run.
+	scheduledAt   time.Time
+	params        map[string]string
+	parentOutputs map[string]string
 }
 
 var (
@@ -31,6 +56,8 @@ var (
 	ErrCmdIsEmpty        = errors.New("Job Command is empty.")
 	ErrJobTypeInvalid    = errors.New("Job Type is not valid.")
 	ErrInvalidDelimiters = errors.New("Job has invalid templating delimiters.")
+	ErrJobTimedOut       = errors.New("Job timed out")
+	ErrJobCancelled      = errors.New("Job was cancelled")
 )
 
 // Run calls the appropriate run function, collects metadata around the success
@@ -40,6 +67,7 @@ func (j *JobRunner) Run(cache JobCache) (*types.JobStat, types.Metadata, error)
 	defer j.job.lock.RUnlock()
 
 	j.meta.LastAttemptedRun = j.job.clk.Time().Now()
+	j.meta.LastScheduledRun = j.scheduledAt
 
 	_, err := cache.Get(j.job.Id)
 	if errors.Is(err, ErrJobDoesntExist) {
@@ -50,25 +78,38 @@ func (j *JobRunner) Run(cache JobCache) (*types.JobStat, types.Metadata, error)
 		Logger.Infof("Job %s tried to run, but exited early because its disabled.", j.job.Name)
 		return nil, j.meta, ErrJobDisabled
 	}
-	err = j.job.start()
+	if j.lease == "" {
+		j.lease = j.job.newLease()
+	}
+	err = j.job.start(j.lease, j.occurrence)
 	if err != nil {
 		return nil, j.meta, err
 	}
 	defer func() {
-		err := j.job.finish()
+		err := j.job.finish(j.lease)
 		if err != nil {
 			Logger.Errorf("Job %s finished error: %s.", j.job.Name, err.Error())
 		}
 	}()
+	defer j.job.heartbeat(j.lease)()
+	var stopCancel, stopLog func()
+	j.ctx, stopCancel = j.job.cancellableRun()
+	defer stopCancel()
+	j.log, stopLog = j.job.startRunLog()
+	defer stopLog()
 
 	Logger.Infof("Job %s:%s started.", j.job.Name, j.job.Id)
 	defer Logger.Infof("Job %s:%s finished.", j.job.Name, j.job.Id)
 
 	j.runSetup()
+	j.parentOutputs = j.job.parentOutputs(cache)
+	j.storeLog()
+	defer j.closeStoredLog()
 
 	var out string
 	for {
 		var err error
+		attemptAt := j.job.clk.Time().Now()
 		switch {
 		case j.job.succeedInstantly:
 			out = "Job succeeded instantly for test purposes."
@@ -80,16 +121,32 @@ func (j *JobRunner) Run(cache JobCache) (*types.JobStat, types.Metadata, error)
 			err = ErrJobTypeInvalid
 		}
 
+		j.recordAttempt(attemptAt, err)
+
+		if err == ErrJobCancelled {
+			j.currentStat.Error = err.Error()
+			j.currentStat.Cancelled = true
+			j.collectStats(false)
+			j.meta.NumberOfFinishedRuns++
+
+			return j.currentStat, j.meta, err
+		}
 		if err != nil {
 			j.currentStat.Error = err.Error()
+			j.currentStat.TimedOut = errors.Is(err, ErrJobTimedOut)
 
 			j.meta.ErrorCount++
 			j.meta.LastError = j.job.clk.Time().Now()
 
 			// Handle retrying
-			if j.shouldRetry() {
-				j.currentRetries--
-				continue
+			delay := retryDelay(&j.job.RetryPolicy, j.job.Retries-j.currentRetries+1, j.job.clk.Time().Now())
+			if j.shouldRetry(err, delay) {
+				if err = j.waitRetry(delay); err == nil {
+					j.currentRetries--
+					continue
+				}
+				j.currentStat.Error = err.Error()
+				j.currentStat.Cancelled = true
 			}
 
 			j.collectStats(false)
@@ -101,7 +158,8 @@ func (j *JobRunner) Run(cache JobCache) (*types.JobStat, types.Metadata, error)
 		}
 	}
 	j.currentStat.Response = out
-	Logger.Debugf("Job %s:%s output: %s", j.job.Name, j.job.Id, out)
+	Logger.Debugf("Job %s:%s output: %s", j.job.Name, j.job.Id, j.redact(out))
+	j.job.setLastOutput(j.redact(out))
 	j.meta.SuccessCount++
 	j.meta.NumberOfFinishedRuns++
 	j.meta.LastSuccess = j.job.clk.Time().Now()
@@ -133,7 +191,7 @@ func (j *JobRunner) RemoteRun() (string, error) {
 	// Calculate a response timeout
 	timeout := j.responseTimeout()
 
-	ctx := context.Background()
+	ctx := j.context()
 	if timeout > 0 {
 		var cncl func()
 		ctx, cncl = context.WithTimeout(ctx, timeout)
@@ -152,6 +210,9 @@ func (j *JobRunner) RemoteRun() (string, error) {
 	}
 	values := u.Query()
 	values.Set("jobId", j.job.Id)
+	if runId := j.runId(); runId != "" {
+		values.Set("runId", runId)
+	}
 	u.RawQuery = values.Encode()
 	uri = u.String()
 	body, err := j.tryTemplatize(j.job.RemoteProperties.Body)
@@ -168,36 +229,111 @@ func (j *JobRunner) RemoteRun() (string, error) {
 	}
 
 	// Set default or user's passed headers
-	j.setHeaders(req)
+	if err := j.setHeaders(req); err != nil {
+		return "", err
+	}
+	if err := j.authorize(ctx, req, body); err != nil {
+		return "", err
+	}
 
 	// Do the request
-	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+	client, err := j.httpClient()
 	if err != nil {
 		return "", err
 	}
-	defer res.Body.Close()
-	b, err := io.ReadAll(res.Body)
+	res, err := client.Do(req.WithContext(ctx))
 	if err != nil {
+		if err = j.cancelledOr(err); err != ErrJobCancelled && !j.retryNetworkErrors() {
+			return "", permanentError{err}
+		}
 		return "", err
 	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized && j.job.RemoteProperties.Auth.Type == types.AuthOAuth2 {
+		j.forgetOAuth2Token()
+	}
+	b := newOutputBuffer(j.job.OutputLimit)
+	responseLog := j.logWriter("response")
+	defer responseLog.Close()
+	w := io.MultiWriter(b, responseLog)
+	// The assertions are checked on the whole body, not only the part kept in the stats.
+	assertions := &j.job.RemoteProperties.ResponseAssertions
+	var whole bytes.Buffer
+	if hasResponseAssertions(assertions) {
+		w = io.MultiWriter(w, &whole)
+	}
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return "", j.cancelledOr(err)
+	}
+	if j.currentStat != nil {
+		j.currentStat.OutputTruncated = b.Truncated()
+	}
 
 	// Check if we got any of the status codes the user asked for
 	if j.checkExpected(res.StatusCode) {
-		return string(b), nil
+		if err := checkResponseAssertions(assertions, res.Header, whole.Bytes()); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	} else if !isRetryable(j.job.RemoteProperties.RetryableResponseCodes, res.StatusCode) {
+		return "", permanentError{errors.New(res.Status + b.String())}
 	} else {
-		return "", errors.New(res.Status + string(b))
+		return "", errors.New(res.Status + b.String())
 	}
 }
 
 func initShParser() *shellwords.Parser {
 	shParser := shellwords.NewParser()
-	shParser.ParseEnv = true
+	// The environment variables are replaced by expandEnv, which leaves out the server key.
+	shParser.ParseEnv = false
 	shParser.ParseBacktick = true
 	return shParser
 }
 
+var envRe = regexp.MustCompile(`\$({[a-zA-Z0-9_]+}|[a-zA-Z0-9_]+)`)
+
+// expandEnv replaces the environment variables in an argument parsed by shellwords,
+// as its ParseEnv does, except for the server key of the secrets.
+func expandEnv(arg string) string {
+	return envRe.ReplaceAllStringFunc(arg, func(s string) string {
+		name := strings.TrimSuffix(strings.TrimPrefix(s[1:], "{"), "}")
+		if name == SecretKeyEnv {
+			return ""
+		}
+		return os.Getenv(name)
+	})
+}
+
+// jobEnviron returns the environment of Kala inherited by local jobs, without the server key.
+func jobEnviron() []string {
+	env := os.Environ()
+	inherited := env[:0:0]
+	for _, kv := range env {
+		if !strings.HasPrefix(kv, SecretKeyEnv+"=") {
+			inherited = append(inherited, kv)
+		}
+	}
+	return inherited
+}
+
 func (j *JobRunner) runCmd() (string, error) {
+	out, err := j.runCmdAttempt()
+	if err != nil && err != ErrJobCancelled && !errors.Is(err, ErrJobTimedOut) &&
+		len(j.job.LocalProperties.RetryableExitCodes) > 0 {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || !isRetryable(j.job.LocalProperties.RetryableExitCodes, exitErr.ExitCode()) {
+			return out, permanentError{err}
+		}
+	}
+	return out, err
+}
+
+func (j *JobRunner) runCmdAttempt() (string, error) {
 	j.numberOfAttempts++
+	ctx := j.context()
+	if ctx.Err() != nil {
+		return "", ErrJobCancelled
+	}
 
 	// Get the actual command we're going to be running,
 	// including any necessary templating.
@@ -215,13 +351,179 @@ func (j *JobRunner) runCmd() (string, error) {
 	if len(args) == 0 {
 		return "", ErrCmdIsEmpty
 	}
+	for i := range args {
+		args[i] = expandEnv(args[i])
+	}
 
 	cmd := exec.Command(args[0], args[1:]...) //nolint:gosec // That's the job description
-	out, err := cmd.CombinedOutput()
+	if err := j.setCmdEnvironment(cmd); err != nil {
+		return "", err
+	}
+	stdout, stderr := newOutputBuffer(j.job.OutputLimit), newOutputBuffer(j.job.OutputLimit)
+	stdoutLog, stderrLog := j.logWriter("stdout"), j.logWriter("stderr")
+	defer stdoutLog.Close()
+	defer stderrLog.Close()
+	cmd.Stdout = io.MultiWriter(stdout, stdoutLog)
+	cmd.Stderr = io.MultiWriter(stderr, stderrLog)
+	setProcessGroup(cmd)
+	setWaitDelay(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var timeoutChan <-chan time.Time
+	timeout := j.commandTimeout()
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutChan = timer.C
+	}
+	select {
+	case err = <-done:
+	case <-timeoutChan:
+		j.killCmd(cmd, done)
+		j.recordOutput(cmd, stdout, stderr)
+		return "", fmt.Errorf("%w after %s", ErrJobTimedOut, timeout)
+	case <-ctx.Done():
+		j.killCmd(cmd, done)
+		j.recordOutput(cmd, stdout, stderr)
+		return "", ErrJobCancelled
+	}
+	j.recordOutput(cmd, stdout, stderr)
 	if err != nil {
-		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(string(out)))
+		// The stderr is recorded in the stat already.
+		return "", err
 	}
-	return strings.TrimSpace(string(out)), nil
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// recordOutput records the exit code and outputs of a finished command in the current stat.
+func (j *JobRunner) recordOutput(cmd *exec.Cmd, stdout, stderr *outputBuffer) {
+	if j.currentStat == nil {
+		return
+	}
+	exitCode := cmd.ProcessState.ExitCode()
+	j.currentStat.ExitCode = &exitCode
+	j.currentStat.Stdout = stdout.String()
+	j.currentStat.Stderr = stderr.String()
+	// The response of a local job is its stdout, as before it was recorded on its own.
+	j.currentStat.Response = strings.TrimSpace(j.currentStat.Stdout)
+	j.currentStat.OutputTruncated = stdout.Truncated() || stderr.Truncated()
+}
+
+// setCmdEnvironment sets the environment variables, working directory, user
+// and standard input of the command from the job's local properties.
+func (j *JobRunner) setCmdEnvironment(cmd *exec.Cmd) error {
+	props := j.job.LocalProperties
+
+	var err error
+	if cmd.Dir, err = j.tryTemplatize(props.Dir); err != nil {
+		return fmt.Errorf("Error templatizing dir: %v", err)
+	}
+
+	cmd.Env = []string{}
+	if !props.ClearEnv {
+		cmd.Env = jobEnviron()
+	}
+	if len(props.Env) > 0 {
+		keys := make([]string, 0, len(props.Env))
+		for key := range props.Env {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value, err := j.tryTemplatize(props.Env[key])
+			if err != nil {
+				return fmt.Errorf("Error templatizing env %s: %v", key, err)
+			}
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+
+	if props.Stdin != "" {
+		stdin, err := j.tryTemplatize(props.Stdin)
+		if err != nil {
+			return fmt.Errorf("Error templatizing stdin: %v", err)
+		}
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	if props.Uid != nil || props.Gid != nil {
+		return setCredential(cmd, props.Uid, props.Gid)
+	}
+	return nil
+}
+
+// How long the output of a killed command is read, see setWaitDelay.
+var killWaitDelay = 5 * time.Second
+
+// killCmd kills a started command and the processes it started, and waits for it.
+func (j *JobRunner) killCmd(cmd *exec.Cmd, done <-chan error) {
+	if err := killProcessGroup(cmd); err != nil {
+		Logger.Errorf("Job %s:%s error killing its command: %s", j.job.Name, j.job.Id, err)
+	}
+	<-done
+}
+
+// logWriter returns a writer of the stream of the run's output,
+// for its followers and to the LogStore, to close once the output ends.
+func (j *JobRunner) logWriter(stream string) io.WriteCloser {
+	var writers []io.Writer
+	if j.log != nil {
+		writers = append(writers, j.log.writer(stream))
+	}
+	if j.storedLog != nil {
+		writers = append(writers, j.storedLog)
+	}
+	return &redactingWriter{j: j, w: io.MultiWriter(writers...)}
+}
+
+// storeLog starts storing the output of the run to the LogStore.
+func (j *JobRunner) storeLog() {
+	if LogStore == nil {
+		return
+	}
+	w, err := LogStore.Create(j.job.Id, j.runId())
+	if err != nil {
+		Logger.Errorf("Job %s:%s error storing the log of run %s: %s", j.job.Name, j.job.Id, j.runId(), err)
+		return
+	}
+	j.storedLog = &lockedWriter{w: w}
+}
+
+func (j *JobRunner) closeStoredLog() {
+	if j.storedLog == nil {
+		return
+	}
+	if err := j.storedLog.Close(); err != nil {
+		Logger.Errorf("Job %s:%s error storing the log of run %s: %s", j.job.Name, j.job.Id, j.runId(), err)
+	}
+}
+
+// runId returns the id of the run, empty when running outside of Run.
+func (j *JobRunner) runId() string {
+	if j.currentStat == nil {
+		return ""
+	}
+	return j.currentStat.RunId
+}
+
+// context returns the context of the run, cancelled when the run is cancelled.
+func (j *JobRunner) context() context.Context {
+	if j.ctx == nil {
+		return context.Background()
+	}
+	return j.ctx
+}
+
+// cancelledOr returns ErrJobCancelled if the run was cancelled, err otherwise.
+func (j *JobRunner) cancelledOr(err error) error {
+	if j.context().Err() != nil {
+		return ErrJobCancelled
+	}
+	return err
 }
 
 func (j *JobRunner) tryTemplatize(content string) (string, error) {
@@ -241,31 +543,41 @@ func (j *JobRunner) tryTemplatize(content string) (string, error) {
 		return "", ErrInvalidDelimiters
 	}
 
-	t, err := template.New("tmpl").Delims(left, right).Parse(content)
+	// A missing parameter or parent output is empty
+	t, err := template.New("tmpl").Delims(left, right).Option("missingkey=zero").Funcs(templateFuncs).Funcs(template.FuncMap{
+		"secret": j.secret,
+	}).Parse(content)
 	if err != nil {
 		return "", fmt.Errorf("Error parsing template: %v", err)
 	}
 
 	b := bytes.NewBuffer(nil)
-	if err := t.Execute(b, j.job); err != nil {
+	if err := t.Execute(b, j.templateData()); err != nil {
 		return "", fmt.Errorf("Error executing template: %v", err)
 	}
 
 	return b.String(), nil
 }
 
-func (j *JobRunner) shouldRetry() bool {
+// shouldRetry returns whether to retry a failed attempt after delay.
+func (j *JobRunner) shouldRetry(err error, delay time.Duration) bool {
 	// Check number of retries left
 	if j.currentRetries == 0 {
 		return false
 	}
 
+	// Check the failure isn't permanent
+	var permanent permanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
 	// Check Epsilon
-	if j.job.Epsilon != "" && j.job.Schedule != "" {
+	if j.job.Epsilon != "" && j.job.hasSchedule() {
 		if !j.job.epsilonDuration.IsZero() {
 			timeSinceStart := j.job.clk.Time().Now().Sub(j.job.NextRunAt)
 			timeLeftToRetry := j.job.epsilonDuration.RelativeTo(j.job.clk.Time().Now()) - timeSinceStart
-			if timeLeftToRetry < 0 {
+			if timeLeftToRetry < delay {
 				return false
 			}
 		}
@@ -274,9 +586,42 @@ func (j *JobRunner) shouldRetry() bool {
 	return true
 }
 
+// waitRetry waits for delay before a retry, unless the run is cancelled meanwhile.
+func (j *JobRunner) waitRetry(delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+	Logger.Infof("Job %s:%s retrying in %s.", j.job.Name, j.job.Id, delay)
+	timer := j.job.clk.Time().NewTimer(delay)
+	defer timer.Stop()
+
+	// Don't keep the job locked while waiting.
+	j.job.lock.RUnlock()
+	defer j.job.lock.RLock()
+	select {
+	case <-timer.Chan():
+		return nil
+	case <-j.context().Done():
+		return ErrJobCancelled
+	}
+}
+
+// recordAttempt records an attempt of the run in the current stat.
+func (j *JobRunner) recordAttempt(ranAt time.Time, err error) {
+	attempt := types.AttemptStat{RanAt: ranAt}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	j.currentStat.Attempts = append(j.currentStat.Attempts, attempt)
+}
+
 func (j *JobRunner) runSetup() {
 	// Setup Job Stat
 	j.currentStat = NewJobStat(j.job.Id)
+	j.currentStat.Overlap = j.overlap
+	if !j.queuedAt.IsZero() {
+		j.currentStat.Waited = j.job.clk.Time().Now().Sub(j.queuedAt).Round(time.Millisecond).String()
+	}
 
 	// Init retries
 	j.currentRetries = j.job.Retries
@@ -290,6 +635,7 @@ func (j *JobRunner) collectStats(success bool) {
 	j.currentStat.Duration = duration.String()
 	j.currentStat.Success = success
 	j.currentStat.NumberOfRetries = j.job.Retries - j.currentRetries
+	j.redactStat()
 }
 
 func (j *JobRunner) checkExpected(statusCode int) bool {
@@ -309,6 +655,39 @@ func (j *JobRunner) checkExpected(statusCode int) bool {
 	return false
 }
 
+// commandTimeout returns the timeout of a local job's command, 0 if none specified
+func (j *JobRunner) commandTimeout() time.Duration {
+	return time.Duration(j.job.LocalProperties.Timeout) * time.Second
+}
+
+// retryNetworkErrors returns whether to retry the network errors of a remote job
+func (j *JobRunner) retryNetworkErrors() bool {
+	retry := j.job.RemoteProperties.RetryNetworkErrors
+	return retry == nil || *retry
+}
+
+// permanentError is the error of a failed attempt not worth retrying.
+type permanentError struct {
+	error
+}
+
+func (e permanentError) Unwrap() error {
+	return e.error
+}
+
+// isRetryable returns whether code is one of the retryable codes, or if any code is.
+func isRetryable(retryable []int, code int) bool {
+	if len(retryable) == 0 {
+		return true
+	}
+	for _, c := range retryable {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
 // responseTimeout sets a default timeout if none specified
 func (j *JobRunner) responseTimeout() time.Duration {
 	responseTimeout := j.job.RemoteProperties.Timeout
@@ -320,8 +699,9 @@ func (j *JobRunner) responseTimeout() time.Duration {
 	return time.Duration(responseTimeout) * time.Second
 }
 
-// setHeaders sets default and user specific headers to the http request
-func (j *JobRunner) setHeaders(req *http.Request) {
+// setHeaders sets default and user specific headers to the http request,
+// the values of the user's headers are templated like the Url.
+func (j *JobRunner) setHeaders(req *http.Request) error {
 	// j.job.lock.Lock()
 	// defer j.job.lock.Unlock()
 
@@ -332,6 +712,19 @@ func (j *JobRunner) setHeaders(req *http.Request) {
 	if j.job.RemoteProperties.Headers["Content-Type"] == nil {
 		j.job.RemoteProperties.Headers["Content-Type"] = []string{"application/json"}
 	}
-	req.Header = j.job.RemoteProperties.Headers
+	req.Header = j.job.RemoteProperties.Headers.Clone()
+	for key, values := range req.Header {
+		for i := range values {
+			value, err := j.tryTemplatize(values[i])
+			if err != nil {
+				return fmt.Errorf("Error templatizing header %s: %v", key, err)
+			}
+			values[i] = value
+		}
+	}
 	req.Header.Set("jobId", j.job.Id)
+	if runId := j.runId(); runId != "" {
+		req.Header.Set("runId", runId)
+	}
+	return nil
 }
@@ -4,7 +4,9 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/lovego/kala/types"
 	"github.com/stretchr/testify/assert"
@@ -150,3 +152,141 @@ func TestTemplatize(t *testing.T) {
 	})
 
 }
+
+func TestLocalRunTimeout(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	// The background sleep keeps the output open after its shell is killed,
+	// unless the whole process group is killed.
+	j.Command = `bash -c 'echo started; sleep 10 & sleep 10'`
+	j.LocalProperties.Timeout = 1
+	j.Retries = 1
+	assert.NoError(t, j.Init(cache))
+
+	start := time.Now()
+	j.Run(cache)
+	assert.True(t, time.Since(start) < 5*time.Second, time.Since(start).String())
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 1)
+	assert.False(t, j.Stats[0].Success)
+	assert.True(t, j.Stats[0].TimedOut)
+	assert.Equal(t, uint(1), j.Stats[0].NumberOfRetries)
+	assert.Equal(t, "Job timed out after 1s", j.Stats[0].Error)
+	assert.Equal(t, "started\n", j.Stats[0].Stdout)
+	assert.Equal(t, -1, *j.Stats[0].ExitCode)
+}
+
+func TestLocalRunTimeoutWithEscapedChild(t *testing.T) {
+	defer func(d time.Duration) { killWaitDelay = d }(killWaitDelay)
+	killWaitDelay = 100 * time.Millisecond
+
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	// The background sleep leaves the process group, so it isn't killed, and keeps the output open.
+	j.Command = `bash -c 'echo started; setsid sleep 10 & sleep 10'`
+	j.LocalProperties.Timeout = 1
+	assert.NoError(t, j.Init(cache))
+
+	start := time.Now()
+	j.Run(cache)
+	assert.True(t, time.Since(start) < 5*time.Second, time.Since(start).String())
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 1)
+	assert.True(t, j.Stats[0].TimedOut)
+	assert.Equal(t, "started\n", j.Stats[0].Stdout)
+}
+
+func TestLocalRunEnvironment(t *testing.T) {
+	dir := t.TempDir()
+	j := &Job{
+		Job: &types.Job{
+			Name:    "mock_job",
+			Owner:   "jedi@master.com",
+			Command: `bash -c 'printenv GREETING HOME; pwd; cat'`,
+			LocalProperties: types.LocalProperties{
+				Env:      map[string]string{"GREETING": "hello {{$.Name}}", "HOME": "/nowhere"},
+				ClearEnv: true,
+				Dir:      dir,
+				Stdin:    "from {{$.Owner}}",
+			},
+			TemplateDelimiters: "{{ }}",
+		},
+	}
+	r := JobRunner{job: j}
+	out, err := r.LocalRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello mock_job\n/nowhere\n"+dir+"\nfrom jedi@master.com", out)
+
+	j.LocalProperties.Env = map[string]string{"GREETING": "{{$.Unknown}}"}
+	_, err = r.LocalRun()
+	assert.Error(t, err)
+}
+
+func TestLocalRunWithoutSecretKey(t *testing.T) {
+	t.Setenv(SecretKeyEnv, "server-key")
+	t.Setenv("GREETING", "hello")
+	j := &Job{
+		Job: &types.Job{
+			Name:    "mock_job",
+			Command: `echo $GREETING ${KALA_SECRET_KEY} $KALA_SECRET_KEY`,
+		},
+	}
+	r := JobRunner{job: j}
+	out, err := r.LocalRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", out)
+
+	j.Command = `bash -c 'echo "$GREETING $KALA_SECRET_KEY"'`
+	out, err = r.LocalRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", out)
+
+	j.LocalProperties.Env = map[string]string{"NAME": "kala"}
+	out, err = r.LocalRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", out)
+}
+
+func TestLocalRunAsUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("Switching user needs root privileges.")
+	}
+	nobody := uint32(65534)
+	j := &Job{
+		Job: &types.Job{
+			Name:            "mock_job",
+			Command:         `bash -c 'echo $(id -u) $(id -g)'`,
+			LocalProperties: types.LocalProperties{Uid: &nobody, Gid: &nobody},
+		},
+	}
+	r := JobRunner{job: j}
+	out, err := r.LocalRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "65534 65534", out)
+}
+
+func TestLocalRunOutput(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = `bash -c 'echo out; echo err >&2; printf "%0.s€" {1..10} >&2; exit 3'`
+	j.OutputLimit = 10
+	j.Retries = 0
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Len(t, j.Stats, 1)
+	stat := j.Stats[0]
+	assert.Equal(t, 3, *stat.ExitCode)
+	assert.Equal(t, "out\n", stat.Stdout)
+	// The 3 bytes long € isn't cut.
+	assert.Equal(t, "err\n€€", stat.Stderr)
+	assert.True(t, stat.OutputTruncated)
+	assert.Equal(t, "out", stat.Response)
+	assert.Equal(t, "exit status 3", stat.Error)
+}
@@ -0,0 +1,260 @@
+package job
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lovego/kala/types"
+)
+
+// SecretKeyEnv is the environment variable of the server key of the secrets,
+// it can't be read by the templates of jobs.
+const SecretKeyEnv = "KALA_SECRET_KEY"
+
+var (
+	// Redis hash of the encrypted secrets, shared by all nodes.
+	secretsKey = "kala-secrets"
+
+	ErrSecretDoesntExist = errors.New("The secret you requested does not exist")
+	ErrInvalidSecret     = errors.New("Invalid Secret. Secret's must contain a Name")
+	ErrNoSecretKey       = errors.New("Secrets need a server key, see SetSecretKey")
+
+	// Cipher of the secrets, nil without a server key.
+	secretCipher     cipher.AEAD
+	secretCipherLock sync.RWMutex
+)
+
+// storedSecret is a secret as stored in Redis, its value encrypted with the server key.
+type storedSecret struct {
+	Name      string    `json:"name"`
+	Nonce     []byte    `json:"nonce"`
+	Encrypted []byte    `json:"encrypted"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetSecretKey sets the server key the secrets are encrypted with, an AES-256 key
+// derived from it. It must be the same on all nodes, and secrets are disabled if empty.
+func SetSecretKey(key string) error {
+	secretCipherLock.Lock()
+	defer secretCipherLock.Unlock()
+	if key == "" {
+		secretCipher = nil
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+	secretCipher, err = cipher.NewGCM(block)
+	return err
+}
+
+func getSecretCipher() (cipher.AEAD, error) {
+	secretCipherLock.RLock()
+	defer secretCipherLock.RUnlock()
+	if secretCipher == nil {
+		return nil, ErrNoSecretKey
+	}
+	return secretCipher, nil
+}
+
+// SetSecret creates or replaces a secret. Its Value is cleared once stored.
+func SetSecret(s *types.Secret) error {
+	if s.Name == "" {
+		return ErrInvalidSecret
+	}
+	aead, err := getSecretCipher()
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	s.UpdatedAt = time.Now().Round(time.Second)
+	// The name is authenticated, so that a value can't be moved to another name.
+	stored := &storedSecret{
+		Name:      s.Name,
+		Nonce:     nonce,
+		Encrypted: aead.Seal(nil, nonce, []byte(s.Value), []byte(s.Name)),
+		UpdatedAt: s.UpdatedAt,
+	}
+	s.Value = ""
+	return hashSet(secretsKey, s.Name, stored)
+}
+
+// GetSecret returns a secret, without its value.
+func GetSecret(name string) (*types.Secret, error) {
+	stored, err := getStoredSecret(name)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Secret{Name: stored.Name, UpdatedAt: stored.UpdatedAt}, nil
+}
+
+// GetAllSecrets returns all secrets by name, without their values.
+func GetAllSecrets() (map[string]*types.Secret, error) {
+	values, err := hashGetAll(secretsKey)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]*types.Secret, len(values))
+	for name, value := range values {
+		stored := &storedSecret{}
+		if err := json.Unmarshal(value, stored); err != nil {
+			return nil, err
+		}
+		secrets[name] = &types.Secret{Name: stored.Name, UpdatedAt: stored.UpdatedAt}
+	}
+	return secrets, nil
+}
+
+// DeleteSecret deletes a secret, the runs of the jobs still referencing it fail.
+func DeleteSecret(name string) error {
+	return hashDelete(secretsKey, name)
+}
+
+func getStoredSecret(name string) (*storedSecret, error) {
+	stored := &storedSecret{}
+	if ok, err := hashGet(secretsKey, name, stored); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrSecretDoesntExist
+	}
+	return stored, nil
+}
+
+// secretValue returns the decrypted value of a secret.
+func secretValue(name string) (string, error) {
+	aead, err := getSecretCipher()
+	if err != nil {
+		return "", err
+	}
+	stored, err := getStoredSecret(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := aead.Open(nil, stored.Nonce, stored.Encrypted, []byte(stored.Name))
+	if err != nil {
+		return "", fmt.Errorf("Error decrypting secret %s: %v", name, err)
+	}
+	return string(value), nil
+}
+
+// secret is the template function resolving a secret of the run. Its value is
+// remembered to be redacted from the run's stat and output.
+func (j *JobRunner) secret(name string) (string, error) {
+	value, err := secretValue(name)
+	if err != nil {
+		return "", err
+	}
+	if value != "" {
+		j.secretsLock.Lock()
+		j.secrets = append(j.secrets, value)
+		j.secretsLock.Unlock()
+	}
+	return value, nil
+}
+
+// redact replaces the values of the secrets resolved by the run in s by RedactedSecret.
+func (j *JobRunner) redact(s string) string {
+	j.secretsLock.Lock()
+	defer j.secretsLock.Unlock()
+	for _, value := range j.secrets {
+		s = strings.ReplaceAll(s, value, RedactedSecret)
+	}
+	return s
+}
+
+// redactStat redacts the secrets of the run from its stat.
+func (j *JobRunner) redactStat() {
+	stat := j.currentStat
+	for _, s := range []*string{&stat.Error, &stat.Response, &stat.Stdout, &stat.Stderr} {
+		*s = j.redact(*s)
+	}
+	for i := range stat.Attempts {
+		stat.Attempts[i].Error = j.redact(stat.Attempts[i].Error)
+	}
+}
+
+// redactingWriter redacts the secrets of the run from the output it writes.
+// The end of a write which may begin a secret is held back until the next write,
+// so a secret split across writes is redacted too. Close writes what is held back.
+type redactingWriter struct {
+	j       *JobRunner
+	w       io.Writer
+	pending []byte
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	data := append(w.pending, p...)
+	cut := len(data) - w.j.longestSecret() + 1
+	if cut > len(data) {
+		cut = len(data)
+	}
+	// A secret may begin in the held back end, but mustn't straddle it.
+	for moved := true; moved && cut > 0; {
+		moved = false
+		for _, value := range w.j.secretValues() {
+			for i := 0; i < cut; {
+				k := strings.Index(string(data[i:]), value)
+				if k < 0 || i+k >= cut {
+					break
+				}
+				if i += k; i+len(value) > cut {
+					cut, moved = i, true
+					break
+				}
+				i += len(value)
+			}
+		}
+	}
+	if cut < 0 {
+		cut = 0
+	}
+	w.pending = append([]byte{}, data[cut:]...)
+	if cut > 0 {
+		if _, err := io.WriteString(w.w, w.j.redact(string(data[:cut]))); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes the end of the output held back by the last write.
+func (w *redactingWriter) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.w, w.j.redact(string(w.pending)))
+	w.pending = nil
+	return err
+}
+
+// secretValues returns the values of the secrets resolved by the run.
+func (j *JobRunner) secretValues() []string {
+	j.secretsLock.Lock()
+	defer j.secretsLock.Unlock()
+	return append([]string{}, j.secrets...)
+}
+
+// longestSecret returns the length of the longest secret resolved by the run.
+func (j *JobRunner) longestSecret() int {
+	n := 0
+	for _, value := range j.secretValues() {
+		if len(value) > n {
+			n = len(value)
+		}
+	}
+	return n
+}
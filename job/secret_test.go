@@ -0,0 +1,126 @@
+package job
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecrets(t *testing.T) {
+	assert.Equal(t, ErrNoSecretKey, SetSecret(&types.Secret{Name: "test_password", Value: "pass"}))
+
+	assert.NoError(t, SetSecretKey("server key"))
+	defer SetSecretKey("")
+	secret := &types.Secret{Name: "test_password", Value: "p@ss w0rd"}
+	assert.NoError(t, SetSecret(secret))
+	defer DeleteSecret("test_password")
+	assert.Empty(t, secret.Value)
+
+	got, err := GetSecret("test_password")
+	assert.NoError(t, err)
+	assert.Equal(t, "test_password", got.Name)
+	assert.Empty(t, got.Value)
+	all, err := GetAllSecrets()
+	assert.NoError(t, err)
+	assert.Empty(t, all["test_password"].Value)
+
+	stored, err := getStoredSecret("test_password")
+	assert.NoError(t, err)
+	assert.NotContains(t, string(stored.Encrypted), "p@ss w0rd")
+	value, err := secretValue("test_password")
+	assert.NoError(t, err)
+	assert.Equal(t, "p@ss w0rd", value)
+
+	assert.NoError(t, SetSecretKey("another key"))
+	_, err = secretValue("test_password")
+	assert.Error(t, err)
+	assert.NoError(t, SetSecretKey("server key"))
+
+	_, err = GetSecret("missing_secret")
+	assert.Equal(t, ErrSecretDoesntExist, err)
+	assert.Equal(t, ErrInvalidSecret, SetSecret(&types.Secret{Value: "value"}))
+}
+
+func TestSecretsInLocalJob(t *testing.T) {
+	assert.NoError(t, SetSecretKey("server key"))
+	defer SetSecretKey("")
+	assert.NoError(t, SetSecret(&types.Secret{Name: "test_password", Value: "p@ssw0rd"}))
+	defer DeleteSecret("test_password")
+
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.Command = `sh -c 'printenv PASSWORD; echo {{ secret "test_password" }} >&2; exit 1'`
+	j.LocalProperties.Env = map[string]string{"PASSWORD": `{{ secret "test_password" }}`}
+	j.TemplateDelimiters = "{{ }}"
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	j.lock.RLock()
+	stat := j.Stats[0]
+	j.lock.RUnlock()
+	assert.Equal(t, "********\n", stat.Stdout)
+	assert.Equal(t, "********\n", stat.Stderr)
+	assert.Equal(t, "********", stat.Response)
+	assert.Equal(t, "exit status 1", stat.Error)
+
+	r, err := LogStore.Open(j.Id, stat.RunId)
+	assert.NoError(t, err)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(b), "p@ssw0rd")
+	assert.Contains(t, string(b), "********")
+}
+
+func TestSecretsInRemoteJob(t *testing.T) {
+	assert.NoError(t, SetSecretKey("server key"))
+	defer SetSecretKey("")
+	assert.NoError(t, SetSecret(&types.Secret{Name: "test_token", Value: "t0ken"}))
+	defer DeleteSecret("test_token")
+
+	var authorization string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		_, _ = io.Copy(w, r.Body)
+	}))
+	defer srv.Close()
+
+	cache := NewMockCache()
+	j := GetMockJobWithGenericSchedule(time.Now())
+	j.JobType = types.RemoteJob
+	j.TemplateDelimiters = "{{ }}"
+	j.RemoteProperties = types.RemoteProperties{
+		Url:     srv.URL,
+		Body:    `{"token": "{{ secret "test_token" }}"}`,
+		Headers: http.Header{"Authorization": {`Bearer {{ secret "test_token" }}`}},
+	}
+	assert.NoError(t, j.Init(cache))
+	j.Run(cache)
+
+	assert.Equal(t, "Bearer t0ken", authorization)
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	assert.Equal(t, `{"token": "********"}`, j.Stats[0].Response)
+	assert.Equal(t, `Bearer {{ secret "test_token" }}`, j.RemoteProperties.Headers.Get("Authorization"))
+}
+
+func TestRedactingWriterSplitSecret(t *testing.T) {
+	r := &JobRunner{secrets: []string{"p@ssw0rd", "key"}}
+	var b bytes.Buffer
+	w := &redactingWriter{j: r, w: &b}
+
+	for _, p := range []string{"password p@ss", "w0rd, key", " k", "e", "y and p@s"} {
+		n, err := w.Write([]byte(p))
+		assert.NoError(t, err)
+		assert.Equal(t, len(p), n)
+	}
+	assert.NotContains(t, b.String(), "w0rd")
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "password ********, ******** ******** and p@s", b.String())
+}
@@ -54,12 +54,30 @@ func NewKalaStats(cache JobCache) *types.KalaStats {
 	ks.NextRunAt = nextRun
 	ks.LastAttemptedRun = lastRun
 
+	if pool != nil {
+		var groups []string
+		seen := map[string]bool{}
+		for _, job := range jobs.Jobs {
+			job.lock.RLock()
+			if name := job.GroupName; name != "" && !seen[name] {
+				seen[name] = true
+				groups = append(groups, name)
+			}
+			job.lock.RUnlock()
+		}
+		var err error
+		if ks.Concurrency, ks.GroupConcurrency, err = concurrencyStats(groups); err != nil {
+			Logger.Errorf("Error getting concurrency stats: %s", err)
+		}
+	}
+
 	return ks
 }
 
 func NewJobStat(id string) *types.JobStat {
 	return &types.JobStat{
 		JobId: id,
+		RunId: newRunId(),
 		RanAt: time.Now(),
 	}
 }
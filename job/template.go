@@ -0,0 +1,126 @@
+package job
+
+import (
+	"encoding/json"
+	"os"
+	"text/template"
+	"time"
+
+	"github.com/lovego/kala/types"
+)
+
+// TemplateData is the data the templates of a job are executed with:
+// the fields of the job, and those of its run.
+type TemplateData struct {
+	*types.Job
+
+	// Time the run was scheduled at, without the job's jitter. The time it
+	// started at if it wasn't scheduled, e.g. if it was started through the API.
+	ScheduledAt time.Time
+	// Time the run started at.
+	StartedAt time.Time
+	// Number of the attempt of the run, 1 for the first one, 2 for the first retry...
+	Attempt int
+	RunId   string
+	// Time of the last successful run of the job before this one, zero if none.
+	LastSuccess time.Time
+	// Outputs of the last successful runs of the parent jobs since Kala started, by id:
+	// the response of remote jobs and the standard output of local ones.
+	ParentOutputs map[string]string
+	// Parameters of a run started through the API.
+	Params map[string]string
+}
+
+// templateFuncs are the helper functions of the templates of jobs.
+var templateFuncs = template.FuncMap{
+	// {{ now }}
+	"now": time.Now,
+	// {{ date "2006-01-02" .ScheduledAt }}
+	"date": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+	// {{ .ScheduledAt | inZone "Asia/Shanghai" | date "15:04" }}
+	"inZone": func(name string, t time.Time) (time.Time, error) {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.In(location), nil
+	},
+	// {{ .ScheduledAt | addDuration "-1h30m" }}
+	"addDuration": func(duration string, t time.Time) (time.Time, error) {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.Add(d), nil
+	},
+	// {{ .ScheduledAt | addDate 0 0 -1 | date "2006-01-02" }}
+	"addDate": func(years, months, days int, t time.Time) time.Time {
+		return t.AddDate(years, months, days)
+	},
+	// {{ toJson .Params }}
+	"toJson": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	// {{ env "HOME" }}
+	"env": templateEnv,
+}
+
+// templateEnv returns the value of an environment variable of Kala,
+// except for the server key of the secrets.
+func templateEnv(name string) string {
+	if name == SecretKeyEnv {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+// templateData returns the data of the templates of the current attempt.
+func (j *JobRunner) templateData() *TemplateData {
+	data := &TemplateData{
+		Job:           j.job.Job,
+		ScheduledAt:   j.scheduledAt,
+		Attempt:       1,
+		LastSuccess:   j.meta.LastSuccess,
+		ParentOutputs: j.parentOutputs,
+		Params:        j.params,
+	}
+	if stat := j.currentStat; stat != nil {
+		data.StartedAt = stat.RanAt
+		data.Attempt = len(stat.Attempts) + 1
+		data.RunId = stat.RunId
+	}
+	if data.ScheduledAt.IsZero() {
+		data.ScheduledAt = data.StartedAt
+	}
+	return data
+}
+
+// parentOutputs returns the outputs of the last successful runs of the job's parents.
+func (j *Job) parentOutputs(cache JobCache) map[string]string {
+	if len(j.ParentJobs) == 0 {
+		return nil
+	}
+	outputs := make(map[string]string, len(j.ParentJobs))
+	for _, id := range j.ParentJobs {
+		parent, err := cache.Get(id)
+		if err != nil {
+			continue
+		}
+		parent.runLock.Lock()
+		if parent.hasLastOutput {
+			outputs[id] = parent.lastOutput
+		}
+		parent.runLock.Unlock()
+	}
+	return outputs
+}
+
+// setLastOutput records the output of the job's last successful run, for its dependent jobs.
+func (j *Job) setLastOutput(out string) {
+	j.runLock.Lock()
+	defer j.runLock.Unlock()
+	j.lastOutput, j.hasLastOutput = out, true
+}
@@ -0,0 +1,89 @@
+package job
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateData(t *testing.T) {
+	scheduledAt := time.Date(2017, 6, 4, 19, 25, 0, 0, time.UTC)
+	j := GetMockJob()
+	j.TemplateDelimiters = "{{ }}"
+	r := &JobRunner{
+		job:           j,
+		scheduledAt:   scheduledAt,
+		params:        map[string]string{"day": "monday"},
+		parentOutputs: map[string]string{"parent": "42"},
+		currentStat:   NewJobStat(j.Id),
+	}
+	r.currentStat.Attempts = []types.AttemptStat{{RanAt: time.Now(), Error: "exit status 1"}}
+
+	templatize := func(content string) string {
+		out, err := r.tryTemplatize(content)
+		assert.NoError(t, err)
+		return out
+	}
+	assert.Equal(t, "mock_job "+r.currentStat.RunId+" 2", templatize("{{ .Name }} {{ .RunId }} {{ .Attempt }}"))
+	assert.Equal(t, "2017-06-04 19:25", templatize(`{{ date "2006-01-02 15:04" .ScheduledAt }}`))
+	assert.Equal(t, "2017-06-03", templatize(`{{ .ScheduledAt | addDate 0 0 -1 | date "2006-01-02" }}`))
+	assert.Equal(t, "17:55", templatize(`{{ .ScheduledAt | addDuration "-1h30m" | date "15:04" }}`))
+	assert.Equal(t, "03:25", templatize(`{{ .ScheduledAt | inZone "Asia/Shanghai" | date "15:04" }}`))
+	assert.Equal(t, `monday {"day":"monday"} 42`, templatize(`{{ .Params.day }} {{ toJson .Params }} {{ .ParentOutputs.parent }}`))
+	assert.Equal(t, r.currentStat.RanAt.Format(time.RFC3339), templatize(`{{ .StartedAt.Format "2006-01-02T15:04:05Z07:00" }}`))
+
+	os.Setenv("KALA_TEMPLATE_TEST", "value")
+	os.Setenv(SecretKeyEnv, "server key")
+	defer os.Unsetenv("KALA_TEMPLATE_TEST")
+	defer os.Unsetenv(SecretKeyEnv)
+	assert.Equal(t, "value ", templatize(`{{ env "KALA_TEMPLATE_TEST" }} {{ env "KALA_SECRET_KEY" }}`))
+
+	_, err := r.tryTemplatize(`{{ .ScheduledAt | addDuration "1 day" }}`)
+	assert.Error(t, err)
+
+	r = &JobRunner{job: j, currentStat: NewJobStat(j.Id)}
+	assert.Equal(t, r.currentStat.RanAt.String(), templatize("{{ .ScheduledAt }}"))
+}
+
+func TestTemplateParentOutputsAndParams(t *testing.T) {
+	cache := NewMockCache()
+	parent := GetMockJobWithGenericSchedule(time.Now())
+	parent.Command = "echo parent output"
+	assert.NoError(t, parent.Init(cache))
+
+	child := GetMockJob()
+	child.Command = `echo {{ index .ParentOutputs "` + parent.Id + `" }} {{ .Params.day }}`
+	child.TemplateDelimiters = "{{ }}"
+	child.ParentJobs = []string{parent.Id}
+	assert.NoError(t, child.Init(cache))
+
+	parent.RunWithParams(cache, map[string]string{"day": "ignored"})
+	child.lock.RLock()
+	assert.Equal(t, "parent output\n", child.Stats[len(child.Stats)-1].Stdout)
+	child.lock.RUnlock()
+
+	child.RunWithParams(cache, map[string]string{"day": "monday"})
+	child.lock.RLock()
+	defer child.lock.RUnlock()
+	assert.Equal(t, "parent output monday\n", child.Stats[len(child.Stats)-1].Stdout)
+}
+
+func TestTemplateScheduledAtOfManualRun(t *testing.T) {
+	cache := NewMockCache()
+	j := GetMockRecurringJobWithSchedule(time.Now().Add(time.Hour), "PT1H")
+	j.Command = `echo {{ .ScheduledAt.Unix }}`
+	j.TemplateDelimiters = "{{ }}"
+	assert.NoError(t, j.Init(cache))
+	defer j.StopTimer()
+
+	// A run started by hand isn't the scheduled one, so it's scheduled when it starts.
+	j.RunWithParams(cache, nil)
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	stat := j.Stats[len(j.Stats)-1]
+	assert.Equal(t, fmt.Sprintf("%d\n", stat.RanAt.Unix()), stat.Stdout)
+}
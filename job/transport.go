@@ -0,0 +1,197 @@
+package job
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/lovego/kala/types"
+)
+
+var (
+	// Redis hash of the named transports, shared by all nodes.
+	transportsKey = "kala-transports"
+
+	ErrTransportDoesntExist = errors.New("The transport you requested does not exist")
+	ErrInvalidTransport     = errors.New("Invalid Transport. Transport's must contain a Name")
+
+	// Clients of the transports in use, by name for the named ones,
+	// or by job id for the jobs' own.
+	httpClients     = map[string]*httpClient{}
+	httpClientsLock sync.Mutex
+)
+
+const maxRedirects = 10
+
+// SetTransport creates or replaces a named transport.
+func SetTransport(t *types.Transport) error {
+	if t.Name == "" {
+		return ErrInvalidTransport
+	}
+	if _, err := newHttpClient(t); err != nil {
+		return err
+	}
+	return hashSet(transportsKey, t.Name, t)
+}
+
+// GetTransport returns a named transport.
+func GetTransport(name string) (*types.Transport, error) {
+	t := &types.Transport{}
+	if ok, err := hashGet(transportsKey, name, t); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrTransportDoesntExist
+	}
+	return t, nil
+}
+
+// GetAllTransports returns all named transports by name.
+func GetAllTransports() (map[string]*types.Transport, error) {
+	values, err := hashGetAll(transportsKey)
+	if err != nil {
+		return nil, err
+	}
+	transports := make(map[string]*types.Transport, len(values))
+	for name, value := range values {
+		t := &types.Transport{}
+		if err := json.Unmarshal(value, t); err != nil {
+			return nil, err
+		}
+		transports[name] = t
+	}
+	return transports, nil
+}
+
+// DeleteTransport deletes a named transport, the requests of the jobs
+// still referencing it fail.
+func DeleteTransport(name string) error {
+	return hashDelete(transportsKey, name)
+}
+
+// RedactedTransport returns a copy of a transport to return through the API,
+// with its client key replaced by RedactedSecret.
+func RedactedTransport(t *types.Transport) *types.Transport {
+	if t == nil || t.ClientKey == "" {
+		return t
+	}
+	redacted := *t
+	redacted.ClientKey = RedactedSecret
+	return &redacted
+}
+
+func validateTransport(t *types.Transport) error {
+	if t == nil {
+		return nil
+	}
+	_, err := newHttpClient(t)
+	return err
+}
+
+// httpClient is the client of a transport, kept as long as its settings don't change.
+type httpClient struct {
+	settings string
+	*http.Client
+}
+
+// httpClient returns the client of the remote job's transport.
+func (j *JobRunner) httpClient() (*http.Client, error) {
+	key, t := "job:"+j.job.Id, j.job.RemoteProperties.Transport
+	if t == nil {
+		name := j.job.RemoteProperties.TransportName
+		if name == "" {
+			return http.DefaultClient, nil
+		}
+		var err error
+		if t, err = GetTransport(name); err != nil {
+			return nil, fmt.Errorf("Error getting transport %s: %v", name, err)
+		}
+		key = "name:" + name
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+
+	httpClientsLock.Lock()
+	defer httpClientsLock.Unlock()
+	if c := httpClients[key]; c != nil {
+		if c.settings == string(b) {
+			return c.Client, nil
+		}
+		c.CloseIdleConnections()
+	}
+	c, err := newHttpClient(t)
+	if err != nil {
+		return nil, err
+	}
+	httpClients[key] = &httpClient{settings: string(b), Client: c}
+	return c, nil
+}
+
+// forgetHttpClient closes the idle connections of a job's own transport, once it's deleted.
+func forgetHttpClient(jobId string) {
+	httpClientsLock.Lock()
+	defer httpClientsLock.Unlock()
+	if c := httpClients["job:"+jobId]; c != nil {
+		c.CloseIdleConnections()
+		delete(httpClients, "job:"+jobId)
+	}
+}
+
+func newHttpClient(t *types.Transport) (*http.Client, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify} //nolint:gosec // Opted in by the user
+	if t.CaCert != "" {
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM([]byte(t.CaCert)) {
+			return nil, errors.New("Invalid transport CA certificate, no PEM certificate found")
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if t.ClientCert != "" || t.ClientKey != "" {
+		cert, err := tls.X509KeyPair([]byte(t.ClientCert), []byte(t.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid transport client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	if t.ProxyUrl != "" {
+		proxy, err := url.Parse(t.ProxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid transport proxy url: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	client := &http.Client{Transport: transport}
+	switch t.RedirectPolicy {
+	case "", types.RedirectFollow:
+	case types.RedirectSameHost:
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Host != via[0].URL.Host {
+				return fmt.Errorf("redirect to another host %s refused", req.URL.Host)
+			}
+			return nil
+		}
+	case types.RedirectNone:
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	default:
+		return nil, fmt.Errorf("Invalid transport redirect policy %s", t.RedirectPolicy)
+	}
+	return client, nil
+}
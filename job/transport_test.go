@@ -0,0 +1,144 @@
+package job
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransportTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+	caCert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}))
+	clientCert, clientKey := generateCertificate(t, "kala")
+
+	j := GetMockRemoteJob(types.RemoteProperties{Url: srv.URL, Transport: &types.Transport{CaCert: caCert}})
+	_, err := (&JobRunner{job: j}).RemoteRun()
+	assert.Error(t, err)
+
+	j.RemoteProperties.Transport.ClientCert = clientCert
+	j.RemoteProperties.Transport.ClientKey = clientKey
+	assert.NoError(t, validateTransport(j.RemoteProperties.Transport))
+	out, err := (&JobRunner{job: j}).RemoteRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "kala", out)
+
+	redacted := Redacted(j.Job).RemoteProperties.Transport
+	assert.Equal(t, RedactedSecret, redacted.ClientKey)
+	assert.Equal(t, clientCert, redacted.ClientCert)
+	assert.Equal(t, clientKey, j.RemoteProperties.Transport.ClientKey)
+
+	forgetHttpClient(j.Id)
+	j.RemoteProperties.Transport = &types.Transport{ClientCert: clientCert, ClientKey: clientKey, InsecureSkipVerify: true}
+	out, err = (&JobRunner{job: j}).RemoteRun()
+	assert.NoError(t, err)
+	assert.Equal(t, "kala", out)
+
+	for _, invalid := range []types.Transport{
+		{CaCert: "ca"},
+		{ClientCert: clientCert},
+		{ProxyUrl: "http://proxy:port"},
+		{RedirectPolicy: "always"},
+	} {
+		assert.Error(t, validateTransport(&invalid))
+	}
+}
+
+func TestTransportProxyAndRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("target"))
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusFound)
+	}))
+	defer srv.Close()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("proxied " + r.URL.Host))
+	}))
+	defer proxy.Close()
+
+	run := func(transport *types.Transport) (string, error) {
+		j := GetMockRemoteJob(types.RemoteProperties{
+			Url: srv.URL, Transport: transport, ExpectedResponseCodes: []int{http.StatusOK, http.StatusFound},
+		})
+		defer forgetHttpClient(j.Id)
+		return (&JobRunner{job: j}).RemoteRun()
+	}
+
+	out, err := run(&types.Transport{})
+	assert.NoError(t, err)
+	assert.Equal(t, "target", out)
+
+	_, err = run(&types.Transport{RedirectPolicy: types.RedirectSameHost})
+	assert.Error(t, err)
+
+	out, err = run(&types.Transport{RedirectPolicy: types.RedirectNone})
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Found")
+
+	out, err = run(&types.Transport{ProxyUrl: proxy.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, "proxied "+srv.Listener.Addr().String(), out)
+}
+
+func TestHttpClientReuse(t *testing.T) {
+	j := GetMockRemoteJob(types.RemoteProperties{Url: "http://example.com", Transport: &types.Transport{}})
+	defer forgetHttpClient(j.Id)
+	r := &JobRunner{job: j}
+
+	c1, err := r.httpClient()
+	assert.NoError(t, err)
+	c2, err := r.httpClient()
+	assert.NoError(t, err)
+	assert.True(t, c1 == c2)
+
+	j.RemoteProperties.Transport.RedirectPolicy = types.RedirectNone
+	c3, err := r.httpClient()
+	assert.NoError(t, err)
+	assert.False(t, c1 == c3)
+
+	j.RemoteProperties.Transport = nil
+	c4, err := r.httpClient()
+	assert.NoError(t, err)
+	assert.True(t, c4 == http.DefaultClient)
+
+	j.RemoteProperties.TransportName = "missing-transport"
+	_, err = r.httpClient()
+	assert.Error(t, err)
+}
+
+// generateCertificate returns a self-signed PEM certificate and key.
+func generateCertificate(t *testing.T, commonName string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}))
+}
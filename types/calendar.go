@@ -0,0 +1,40 @@
+package types
+
+import "time"
+
+// Calendar is a named set of blackout windows, during which the jobs
+// referencing it, directly or through their group, don't run.
+type Calendar struct {
+	Name string `json:"name"`
+
+	// Date ranges, e.g. a deploy freeze or holidays.
+	Ranges []DateRange `json:"ranges"`
+
+	// Windows repeating every week, e.g. week-ends.
+	Weekly []WeeklyWindow `json:"weekly"`
+
+	// IANA time zone of the weekly windows, e.g. "Europe/Berlin".
+	// The server's local time zone by default.
+	TimeZone string `json:"time_zone"`
+
+	// If true, a run falling inside a window is deferred to the end of the window.
+	// Otherwise it is skipped, and recorded as such in the job's stats.
+	Defer bool `json:"defer"`
+}
+
+// DateRange is a blackout window from Start up to, but not including, End.
+type DateRange struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Summary string    `json:"summary"`
+}
+
+// WeeklyWindow is a blackout window from Start to End on each of Days.
+// Start and End are times of day like "22:00", End may be "24:00".
+// If End isn't after Start, the window ends on the next day,
+// e.g. from Friday "18:00" to Saturday "06:00".
+type WeeklyWindow struct {
+	Days  []time.Weekday `json:"days"`
+	Start string         `json:"start"`
+	End   string         `json:"end"`
+}
@@ -2,11 +2,69 @@ package types
 
 const (
 	// Base API v1 Path
-	ApiUrlPrefix = "/api/v1"
-	JobPath      = "/job"
+	ApiUrlPrefix  = "/api/v1"
+	JobPath       = "/job"
+	CalendarPath  = "/calendar"
+	GroupPath     = "/group"
+	TransportPath = "/transport"
+	SecretPath    = "/secret"
 )
 
 const (
 	LocalJob JobType = iota
 	RemoteJob
 )
+
+const (
+	// Run once for all the missed runs.
+	MisfireFireOnce MisfirePolicy = "fire_once"
+	// Run once for each missed run, up to MisfireLimit times.
+	MisfireFireAll MisfirePolicy = "fire_all"
+	// Skip all the missed runs.
+	MisfireSkip MisfirePolicy = "skip"
+	// Run once if the last missed run is within MisfireGrace, otherwise skip all.
+	MisfireGrace MisfirePolicy = "grace"
+)
+
+const (
+	// Skip the run, recorded as skipped in the Stats.
+	OverlapSkip OverlapPolicy = "skip"
+	// Run once the previous runs are done, at most one run is queued and the others are skipped.
+	OverlapQueue OverlapPolicy = "queue"
+	// Cancel the previous runs and run.
+	OverlapReplace OverlapPolicy = "replace"
+)
+
+const (
+	// The runs waiting for a slot start in the order they were queued in.
+	QueueFifo QueueOrder = "fifo"
+	// The runs waiting for a slot start by decreasing Priority of their jobs, then in order.
+	QueuePriority QueueOrder = "priority"
+)
+
+const (
+	// Retry after the same Delay each time.
+	RetryFixed RetryBackoff = "fixed"
+	// Retry after Delay, multiplied by Multiplier after each retry, up to MaxDelay.
+	RetryExponential RetryBackoff = "exponential"
+)
+
+const (
+	// HTTP basic authentication with a Username and Password.
+	AuthBasic AuthType = "basic"
+	// Authorization header with a bearer Token.
+	AuthBearer AuthType = "bearer"
+	// Bearer token fetched from TokenUrl with the OAuth2 client credentials grant.
+	AuthOAuth2 AuthType = "oauth2"
+	// Signature of the timestamp and body with the HMAC-SHA256 of Secret.
+	AuthHmac AuthType = "hmac"
+)
+
+const (
+	// Follow up to 10 redirects.
+	RedirectFollow RedirectPolicy = "follow"
+	// Follow up to 10 redirects to the same host, fail on a redirect to another one.
+	RedirectSameHost RedirectPolicy = "same_host"
+	// Don't follow redirects, the redirect response is the response.
+	RedirectNone RedirectPolicy = "none"
+)
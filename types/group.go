@@ -0,0 +1,19 @@
+package types
+
+// Group holds the settings shared by the jobs with its GroupName.
+type Group struct {
+	Name string `json:"name"`
+
+	// Names of the blackout calendars of the jobs in this group.
+	Calendars []string `json:"calendars"`
+
+	// Default Jitter of the jobs in this group, see Job.Jitter.
+	Jitter string `json:"jitter"`
+
+	// Max number of jobs of this group running at once across the cluster,
+	// 2 if 0, no limit if negative.
+	Concurrency int `json:"concurrency"`
+
+	// Order of the runs of this group waiting for a slot, "fifo" or "priority", "fifo" by default.
+	QueueOrder QueueOrder `json:"queue_order"`
+}
@@ -1,6 +1,7 @@
 package types
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 )
@@ -41,12 +42,58 @@ type Job struct {
 	// e.g. "R/2014-03-08T20:00:00.000Z/PT2H"
 	Schedule string `json:"schedule"`
 
+	// Cron expression, an alternative to Schedule.
+	// 5 fields (minute hour day-of-month month day-of-week), 6 fields with
+	// a leading seconds field, or a macro like "@daily".
+	// It can be prefixed with a repeat count the same way as Schedule.
+	// e.g. "30 9 * * MON-FRI" or "R10/0 9 * * MON#1"
+	Cron string `json:"cron"`
+
+	// IANA time zone the Schedule or Cron is evaluated in, e.g. "America/New_York".
+	// A Schedule start datetime without offset is read in this zone, and
+	// days, weeks, months and years are added on its wall clock, so a daily
+	// job keeps its time of day across daylight saving transitions.
+	// A wall clock time skipped by a transition runs that day after the gap
+	// (02:30 runs at 03:30), and a repeated one runs once, on its first occurrence.
+	// Without a time zone, a Schedule uses its start datetime's offset (UTC if
+	// it has none) and a Cron uses the server's local time zone.
+	TimeZone string `json:"time_zone"`
+
+	// No run is scheduled after this time, and the job is done once its next
+	// run would be after it. An end can also be given in the Schedule string,
+	// e.g. "R/2014-03-08T20:00:00Z/P1D/2014-12-31T00:00:00Z", the earlier end wins.
+	ScheduleEnd time.Time `json:"schedule_end"`
+
+	// Names of the blackout calendars during which this job doesn't run,
+	// in addition to those of its group.
+	Calendars []string `json:"calendars"`
+
 	// Number of times to retry on failed attempt for each run.
 	Retries uint `json:"retries"`
 
+	// Max number of runs of this job at once across the cluster, 1 if 0.
+	MaxParallel uint `json:"max_parallel"`
+
+	// What to do with a run fired while the job already runs MaxParallel times:
+	// "skip", "queue" or "replace", "skip" by default.
+	OverlapPolicy OverlapPolicy `json:"overlap_policy"`
+
+	// Priority of the runs of this job waiting for a slot, in a group with the "priority"
+	// QueueOrder, from -100 to 100, higher first.
+	Priority int `json:"priority"`
+
+	// Delay between the retries of a failed attempt, none by default.
+	RetryPolicy RetryPolicy `json:"retry_policy"`
+
 	// Duration in which it is safe to retry the Job.
 	Epsilon string `json:"epsilon"`
 
+	// ISO 8601 Duration over which the runs of jobs with the same schedule are spread.
+	// Each run is delayed by an offset within it, derived from the job's Id, so it is
+	// the same for every run and across restarts. Defaults to the Jitter of its group.
+	// e.g. "PT5M"
+	Jitter string `json:"jitter"`
+
 	NextRunAt time.Time `json:"next_run_at"`
 
 	// Templating delimiters, the left & right separated by space,
@@ -57,7 +104,9 @@ type Job struct {
 	// content as a Go Template with the job itself as data.
 	//
 	// The Command is templated for local jobs,
-	// and Url and Body in RemoteProperties.
+	// and Url, Body and Headers in RemoteProperties.
+	// A template references a secret by its name, e.g. {{ secret "db_password" }},
+	// and its value is redacted from the run's stat and output.
 	TemplateDelimiters string
 
 	// If the job is disabled (or the system inoperative) and we pass
@@ -67,15 +116,37 @@ type Job struct {
 	// until the next scheduled run time comes along.
 	ResumeAtNextScheduledTime bool `json:"resume_at_next_scheduled_time"`
 
+	// What to do with the runs missed while Kala was down, when the job is
+	// reloaded from the db: "fire_once", "fire_all", "skip" or "grace".
+	// The missed runs which aren't fired are recorded as skipped in the Stats.
+	// Without a policy, a missed run is run once as soon as possible,
+	// or skipped if ResumeAtNextScheduledTime is set, without being recorded.
+	MisfirePolicy MisfirePolicy `json:"misfire_policy"`
+
+	// Maximum number of missed runs fired by the "fire_all" policy, the latest ones.
+	// 10 by default.
+	MisfireLimit uint `json:"misfire_limit"`
+
+	// ISO 8601 Duration within which the last missed run is fired by the "grace" policy.
+	// e.g. "PT15M"
+	MisfireGrace string `json:"misfire_grace"`
+
 	// Meta data about successful and failed runs.
 	Metadata Metadata `json:"metadata"`
 
 	// Type of the job
 	JobType JobType `json:"job_type"`
 
+	// Custom properties for the local job type
+	LocalProperties LocalProperties `json:"local_properties"`
+
 	// Custom properties for the remote job type
 	RemoteProperties RemoteProperties `json:"remote_properties"`
 
+	// Number of bytes of the Response, Stdout and Stderr kept in the Stats,
+	// 64 KiB by default, -1 for no limit.
+	OutputLimit int `json:"output_limit"`
+
 	// Collection of Job Stats
 	Stats []*JobStat `json:"stats"`
 
@@ -87,6 +158,36 @@ type Job struct {
 
 	// job running stat from redis, not storage to db
 	IsRunning bool `json:"is_running" sql:"-"`
+	// Id of the node running the job.
+	RunningOn string `json:"running_on,omitempty" sql:"-"`
+}
+
+// LocalProperties Custom properties for the local job type
+// Dir, the values of Env and Stdin are templated like the Command.
+type LocalProperties struct {
+	// A timeout property for the command in seconds, 0 means no timeout.
+	// The command and the processes it started are killed when it expires.
+	Timeout int `json:"timeout" comment:"local job command timeout"`
+
+	// Environment variables of the command, in addition to those of Kala,
+	// unless ClearEnv is set (e.g. {"LANG": "C"}).
+	Env      map[string]string `json:"env" comment:"local job command environment variables"`
+	ClearEnv bool              `json:"clear_env" comment:"don't pass Kala's environment variables to the command"`
+
+	// Working directory of the command, Kala's by default.
+	Dir string `json:"dir" comment:"local job command working directory"`
+
+	// User and group ids to run the command as, Kala's by default.
+	// Kala needs the privileges to switch to them.
+	Uid *uint32 `json:"uid" comment:"local job command user id"`
+	Gid *uint32 `json:"gid" comment:"local job command group id"`
+
+	// Standard input of the command, empty by default.
+	Stdin string `json:"stdin" comment:"local job command standard input"`
+
+	// Exit codes of failed attempts worth retrying (e.g. [75]). Any failed attempt
+	// is retried if empty, otherwise only those exiting with one of these codes or timed out.
+	RetryableExitCodes []int `json:"retryable_exit_codes" comment:"exit codes retried, all if empty"`
 }
 
 // RemoteProperties Custom properties for the remote job type
@@ -100,11 +201,53 @@ type RemoteProperties struct {
 	// A list of headers to add to http request (e.g. [{"key": "charset", "value": "UTF-8"}])
 	Headers http.Header `json:"headers" comment:"remote job http request headers"`
 
+	// Authentication of the http request, none by default.
+	Auth RemoteAuth `json:"auth" comment:"remote job http request authentication"`
+
+	// Name of the shared transport of the http request, or its own Transport.
+	// Go's default http client if neither.
+	TransportName string     `json:"transport_name" comment:"remote job http transport name"`
+	Transport     *Transport `json:"transport" comment:"remote job http transport"`
+
 	// A timeout property for the http request in seconds
 	Timeout int `json:"timeout" comment:"remote job http request timeout"`
 
 	// A list of expected response codes (e.g. [200, 201])
 	ExpectedResponseCodes []int `json:"expected_response_codes" comment:"list of http response codes, default 200"`
+
+	// Unexpected response codes worth retrying (e.g. [502, 503, 504]). Any unexpected
+	// response code is retried if empty, otherwise only these ones.
+	RetryableResponseCodes []int `json:"retryable_response_codes" comment:"list of http response codes retried, all if empty"`
+
+	// Whether to retry on network errors and timeouts, true by default.
+	RetryNetworkErrors *bool `json:"retry_network_errors" comment:"retry on network errors and timeouts, default true"`
+
+	// Assertions on a response with an expected code, which fails if any doesn't hold.
+	ResponseAssertions ResponseAssertions `json:"response_assertions" comment:"remote job http response assertions"`
+}
+
+// ResponseAssertions are checked on the response of a remote job in order:
+// the headers, the body regular expression, then the JSON fields.
+type ResponseAssertions struct {
+	// Headers the response must have, with the given value, or any value if empty
+	// (e.g. {"Content-Type": "application/json", "X-Request-Id": ""}).
+	Headers map[string]string `json:"headers"`
+
+	// Regular expression the body must match (e.g. "(?i)success").
+	BodyRegex string `json:"body_regex"`
+
+	// Values of fields of the JSON body (e.g. [{"path": "$.ok", "value": true}]).
+	Json []JsonAssertion `json:"json"`
+}
+
+// JsonAssertion is the value of a field of a JSON body.
+type JsonAssertion struct {
+	// JSONPath of the field, with dot and bracket child names and array indexes,
+	// e.g. "$.data.items[0].status" or "$['data']['total']".
+	Path string `json:"path"`
+
+	// JSON value the field must equal, e.g. true, "done" or {"code": 0}.
+	Value json.RawMessage `json:"value"`
 }
 
 type Metadata struct {
@@ -114,6 +257,80 @@ type Metadata struct {
 	LastError            time.Time `json:"last_error"`
 	LastAttemptedRun     time.Time `json:"last_attempted_run"`
 	NumberOfFinishedRuns uint      `json:"number_of_finished_runs"`
+
+	// Run point of the schedule of the last run, before the jitter and calendars delayed it,
+	// or zero if the last run wasn't fired by the schedule.
+	LastScheduledRun time.Time `json:"last_scheduled_run"`
 }
 
 type JobType int
+
+type MisfirePolicy string
+
+type OverlapPolicy string
+
+type QueueOrder string
+
+type RetryBackoff string
+
+type AuthType string
+
+// RetryPolicy is the delay before retrying a failed attempt. A retry which
+// would start after the Epsilon of the job isn't made.
+type RetryPolicy struct {
+	// "fixed" or "exponential", no delay if empty.
+	Backoff RetryBackoff `json:"backoff"`
+
+	// ISO 8601 Duration before the first retry, e.g. "PT10S".
+	Delay string `json:"delay"`
+
+	// ISO 8601 Duration capping the exponential delays, e.g. "PT5M". No cap if empty.
+	MaxDelay string `json:"max_delay"`
+
+	// Factor of the exponential delay after each retry, 2 by default.
+	Multiplier float64 `json:"multiplier"`
+
+	// Fraction of each delay, from 0 to 1, by which it is randomly shortened,
+	// so that jobs failing together don't retry together.
+	Jitter float64 `json:"jitter"`
+}
+
+// RemoteAuth is the authentication of a remote job's requests. Its secrets are
+// redacted from the jobs listed by the API, and templated like the Url.
+type RemoteAuth struct {
+	// "basic", "bearer", "oauth2" or "hmac", none if empty.
+	Type AuthType `json:"type"`
+
+	// Credentials of the "basic" auth.
+	Username string `json:"username"`
+	Password string `json:"password"`
+
+	// Token of the "bearer" auth.
+	Token string `json:"token"`
+
+	// Client credentials of the "oauth2" auth, and the url of the token endpoint.
+	// The token is cached by the job until it expires or a response is 401.
+	TokenUrl     string   `json:"token_url"`
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+
+	// Key of the "hmac" auth. The request has the unix time in seconds in the
+	// X-Kala-Timestamp header, and "sha256=" followed by the hex HMAC-SHA256 of
+	// the timestamp, a dot and the body in the X-Kala-Signature header.
+	Secret string `json:"secret"`
+}
+
+// SchedulePreview is a schedule to compute the run times of, without creating a job.
+type SchedulePreview struct {
+	// As in Job, either a Schedule or a Cron.
+	Schedule                  string    `json:"schedule"`
+	Cron                      string    `json:"cron"`
+	TimeZone                  string    `json:"time_zone"`
+	ScheduleEnd               time.Time `json:"schedule_end"`
+	Epsilon                   string    `json:"epsilon"`
+	ResumeAtNextScheduledTime bool      `json:"resume_at_next_scheduled_time"`
+
+	// Number of run times to compute, 10 by default.
+	Count int `json:"count"`
+}
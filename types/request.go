@@ -0,0 +1,7 @@
+package types
+
+// StartJobRequest is the optional body of a request to start a job.
+type StartJobRequest struct {
+	// Parameters of the run, the Params of its templates.
+	Params map[string]string `json:"params"`
+}
@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type KalaStatsResponse struct {
 	Stats *KalaStats
 }
@@ -19,3 +21,39 @@ type AddJobResponse struct {
 type JobResponse struct {
 	Job *Job `json:"job"`
 }
+
+type SchedulePreviewResponse struct {
+	RunTimes []time.Time `json:"run_times"`
+}
+
+type CalendarResponse struct {
+	Calendar *Calendar `json:"calendar"`
+}
+
+type ListCalendarsResponse struct {
+	Calendars map[string]*Calendar `json:"calendars"`
+}
+
+type GroupResponse struct {
+	Group *Group `json:"group"`
+}
+
+type ListGroupsResponse struct {
+	Groups map[string]*Group `json:"groups"`
+}
+
+type TransportResponse struct {
+	Transport *Transport `json:"transport"`
+}
+
+type ListTransportsResponse struct {
+	Transports map[string]*Transport `json:"transports"`
+}
+
+type SecretResponse struct {
+	Secret *Secret `json:"secret"`
+}
+
+type ListSecretsResponse struct {
+	Secrets map[string]*Secret `json:"secrets"`
+}
@@ -0,0 +1,12 @@
+package types
+
+import "time"
+
+// Secret is a named value, e.g. a password, referenced by the templates of jobs
+// as {{ secret "name" }}. It is stored encrypted, and its value is never returned by the API.
+type Secret struct {
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -7,6 +7,7 @@ import (
 // JobStat is used to store metrics about a specific Job .Run()
 type JobStat struct {
 	JobId             string     `json:"job_id"`
+	RunId             string     `json:"run_id"`
 	RanAt             time.Time  `json:"ran_at"`
 	NumberOfRetries   uint       `json:"number_of_retries"`
 	Success           bool       `json:"success"`
@@ -14,7 +15,43 @@ type JobStat struct {
 	Duration          string     `json:"duration,omitempty"`
 	FinishAt          *time.Time `json:"finish_at,omitempty"`
 	Error             string     `json:"error,omitempty"`
-	Response          string     `json:"response,omitempty"`
+	// Response of a remote job, or trimmed stdout of a local job.
+	Response string `json:"response,omitempty"`
+	// Exit code, standard output and error of the last attempt of a local job.
+	// The exit code is -1 if the command was killed by a signal.
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	// The Response, Stdout or Stderr was truncated to the job's OutputLimit.
+	OutputTruncated bool `json:"output_truncated,omitempty"`
+	// An attempt was killed by the job's timeout.
+	TimedOut bool `json:"timed_out,omitempty"`
+	// The run was cancelled through the API, it isn't counted as an error.
+	Cancelled bool `json:"cancelled,omitempty"`
+	// Each attempt of the run, the first one and its retries.
+	Attempts []AttemptStat `json:"attempts,omitempty"`
+	// The run was skipped, e.g. because of a blackout calendar.
+	Skipped    bool   `json:"skipped,omitempty"`
+	SkipReason string `json:"skip_reason,omitempty"`
+	// The overlap policy applied to the run, fired while the job was running.
+	Overlap OverlapPolicy `json:"overlap,omitempty"`
+	// Time the run waited in the queue of its group for a slot, e.g. "1m30s".
+	Waited string `json:"waited,omitempty"`
+}
+
+// AttemptStat is an attempt of a run.
+type AttemptStat struct {
+	RanAt time.Time `json:"ran_at"`
+	Error string    `json:"error,omitempty"`
+}
+
+// LogChunk is a piece of the output of a running job.
+type LogChunk struct {
+	// Sequence number of the chunk in the run.
+	Seq int64 `json:"seq"`
+	// "stdout" or "stderr" for a local job, "response" for a remote job.
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
 }
 
 // KalaStats is the struct for storing app-level metrics
@@ -30,4 +67,18 @@ type KalaStats struct {
 	LastAttemptedRun time.Time `json:"last_attempted_run"`
 
 	CreatedAt time.Time `json:"created"`
+
+	// Slots used and available across the cluster, and in the groups of the jobs by name.
+	Concurrency      ConcurrencyStats            `json:"concurrency"`
+	GroupConcurrency map[string]ConcurrencyStats `json:"group_concurrency"`
+}
+
+// ConcurrencyStats is the number of jobs running at once and its limit, 0 for none,
+// and the runs waiting for a slot.
+type ConcurrencyStats struct {
+	Running int `json:"running"`
+	Limit   int `json:"limit"`
+	Waiting int `json:"waiting"`
+	// Time the run waiting the longest has been waiting, e.g. "1m30s".
+	MaxWait string `json:"max_wait,omitempty"`
 }
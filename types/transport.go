@@ -0,0 +1,28 @@
+package types
+
+// Transport holds the HTTP client settings of remote jobs. It is either
+// named and shared by the jobs with its Name as TransportName, or a job's own.
+// The jobs with the same transport reuse the same connections.
+type Transport struct {
+	Name string `json:"name"`
+
+	// PEM certificates of the CAs trusted in addition to the system ones.
+	CaCert string `json:"ca_cert"`
+
+	// PEM certificate and key presented to the servers asking for one.
+	// The key is redacted from the transports and jobs returned by the API.
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+
+	// Don't verify the certificates of the servers, for tests only.
+	InsecureSkipVerify bool `json:"insecure_skip_verify"`
+
+	// Url of the proxy the requests go through, e.g. "http://proxy:3128".
+	// The HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables by default.
+	ProxyUrl string `json:"proxy_url"`
+
+	// "follow", "same_host" or "none", "follow" by default.
+	RedirectPolicy RedirectPolicy `json:"redirect_policy"`
+}
+
+type RedirectPolicy string
@@ -0,0 +1,311 @@
+package cron
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+var (
+	// ErrBadFormat is returned when parsing fails
+	ErrBadFormat = errors.New("bad cron format string")
+
+	macros = map[string]string{
+		"@yearly":   "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *",
+	}
+
+	months = map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}
+	weekdays = map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}
+)
+
+// How many years Next looks ahead before giving up, e.g. for "0 0 30 2 *".
+const searchYears = 5
+
+type bounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondBounds = bounds{0, 59, nil}
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, months}
+	dowBounds    = bounds{0, 7, weekdays} // both 0 and 7 are Sunday
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	spec string
+
+	second, minute, hour, dom, month, dow uint64
+
+	// "*" or "?" was used for day of month or day of week.
+	domStar, dowStar bool
+
+	// "L" was used for day of month: the last day of the month.
+	lastDom bool
+
+	// "MON#1" style day of week: bit n-1 of nthDow[weekday] is set
+	// for the nth occurrence of that weekday in the month.
+	nthDow [7]uint8
+}
+
+// Parse parses a cron expression. It accepts 5 fields
+// (minute hour day-of-month month day-of-week), 6 fields with a leading
+// seconds field, or one of the macros @yearly, @annually, @monthly,
+// @weekly, @daily, @midnight and @hourly.
+//
+// Each field supports "*", lists ("1,15"), ranges ("1-5"), steps ("*/10",
+// "0-30/5") and names for months and weekdays ("JAN", "MON-FRI").
+// Day of month also supports "L" for the last day of the month, and day of
+// week supports "#" for the nth weekday of the month ("MON#1").
+// As in Vixie cron, if both day of month and day of week are restricted,
+// a time matches when either of them matches.
+func Parse(spec string) (*Schedule, error) {
+	expr := strings.TrimSpace(spec)
+	if strings.HasPrefix(expr, "@") {
+		var ok bool
+		if expr, ok = macros[strings.ToLower(expr)]; !ok {
+			return nil, fmt.Errorf("unknown cron macro %s", spec)
+		}
+	}
+
+	fields := strings.Fields(expr)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, ErrBadFormat
+	}
+
+	s := &Schedule{spec: spec}
+	var err error
+	if s.second, err = parseField(fields[0], secondBounds); err != nil {
+		return nil, err
+	}
+	if s.minute, err = parseField(fields[1], minuteBounds); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[2], hourBounds); err != nil {
+		return nil, err
+	}
+	if err = s.parseDom(fields[3]); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[4], monthBounds); err != nil {
+		return nil, err
+	}
+	if err = s.parseDow(fields[5]); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+func (s *Schedule) parseDom(field string) error {
+	s.domStar = field == "*" || field == "?"
+	var items []string
+	for _, item := range strings.Split(field, ",") {
+		if strings.ToUpper(item) == "L" {
+			s.lastDom = true
+		} else {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	var err error
+	s.dom, err = parseField(strings.Join(items, ","), domBounds)
+	return err
+}
+
+func (s *Schedule) parseDow(field string) error {
+	s.dowStar = field == "*" || field == "?"
+	var items []string
+	for _, item := range strings.Split(field, ",") {
+		i := strings.Index(item, "#")
+		if i < 0 {
+			items = append(items, item)
+			continue
+		}
+		day, err := parseValue(item[:i], dowBounds)
+		if err != nil {
+			return err
+		}
+		nth, err := strconv.Atoi(item[i+1:])
+		if err != nil || nth < 1 || nth > 5 {
+			return fmt.Errorf("invalid cron weekday occurrence %s", item)
+		}
+		s.nthDow[day%7] |= 1 << uint(nth-1)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	var err error
+	if s.dow, err = parseField(strings.Join(items, ","), dowBounds); err != nil {
+		return err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return nil
+}
+
+// parseField returns the bits set by a comma separated list of items.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		itemBits, err := parseItem(item, b)
+		if err != nil {
+			return 0, err
+		}
+		bits |= itemBits
+	}
+	return bits, nil
+}
+
+// parseItem parses "*", "?", "a", "a-b" each optionally followed by "/step".
+func parseItem(item string, b bounds) (uint64, error) {
+	rangePart, step := item, 1
+	if i := strings.Index(item, "/"); i >= 0 {
+		var err error
+		rangePart = item[:i]
+		if step, err = strconv.Atoi(item[i+1:]); err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid cron step in %s", item)
+		}
+	}
+
+	var start, end int
+	switch {
+	case rangePart == "*" || rangePart == "?":
+		start, end = b.min, b.max
+	case strings.Contains(rangePart, "-"):
+		parts := strings.SplitN(rangePart, "-", 2)
+		var err error
+		if start, err = parseValue(parts[0], b); err != nil {
+			return 0, err
+		}
+		if end, err = parseValue(parts[1], b); err != nil {
+			return 0, err
+		}
+	default:
+		var err error
+		if start, err = parseValue(rangePart, b); err != nil {
+			return 0, err
+		}
+		end = start
+		// "a/step" means from a to the maximum.
+		if rangePart != item {
+			end = b.max
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("invalid cron range %s", item)
+	}
+
+	var bits uint64
+	for v := start; v <= end; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func parseValue(value string, b bounds) (int, error) {
+	if v, ok := b.names[strings.ToUpper(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cron value %s", value)
+	}
+	if v < b.min || v > b.max {
+		return 0, fmt.Errorf("cron value %d out of range [%d, %d]", v, b.min, b.max)
+	}
+	return v, nil
+}
+
+// Next returns the first activation time strictly after t, in t's location.
+// It returns the zero time if there is none within the next few years.
+// Activation times are wall clock times, resolved by iso8601.Date:
+// one skipped by a daylight saving transition activates right after the gap,
+// and one repeated by a transition activates only on its first occurrence.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	// Walk the wall clock as if it were UTC,
+	// so the field arithmetic isn't disturbed by zone offsets.
+	w := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	w = w.Add(time.Second)
+	for {
+		if w = s.nextWall(w, t.Year()+searchYears); w.IsZero() {
+			return w
+		}
+		at := iso8601.Date(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), 0, loc)
+		if at.After(t) {
+			return at
+		}
+		w = w.Add(time.Second)
+	}
+}
+
+// nextWall returns the first matching wall clock time at or after w.
+func (s *Schedule) nextWall(w time.Time, yearLimit int) time.Time {
+	for w.Year() <= yearLimit {
+		if s.month&(1<<uint(w.Month())) == 0 {
+			w = time.Date(w.Year(), w.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchDay(w) {
+			w = time.Date(w.Year(), w.Month(), w.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(w.Hour())) == 0 {
+			w = w.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(w.Minute())) == 0 {
+			w = w.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if s.second&(1<<uint(w.Second())) == 0 {
+			w = w.Add(time.Second)
+			continue
+		}
+		return w
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) matchDay(w time.Time) bool {
+	day, weekday := w.Day(), int(w.Weekday())
+	lastDay := time.Date(w.Year(), w.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+
+	domMatch := s.dom&(1<<uint(day)) != 0 || (s.lastDom && day == lastDay)
+	dowMatch := s.dow&(1<<uint(weekday)) != 0 || s.nthDow[weekday]&(1<<uint((day-1)/7)) != 0
+
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
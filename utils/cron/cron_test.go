@@ -0,0 +1,103 @@
+package cron_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/utils/cron"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{
+		"* * * * *",
+		"30 9 * * MON-FRI",
+		"0 30 9 * * 1-5",
+		"*/15 0-6/2 1,15 JAN-MAR ?",
+		"0 0 L * *",
+		"0 9 ? * MON#1",
+		"@daily",
+		"@HOURLY",
+	} {
+		_, err := cron.Parse(spec)
+		assert.NoError(t, err, spec)
+	}
+
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"* * * * MON#6",
+		"* * * * FOO",
+		"@every",
+	} {
+		_, err := cron.Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	from := time.Date(2021, time.January, 30, 10, 15, 20, 500, time.UTC) // Saturday
+	for _, c := range []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.January, 30, 10, 16, 0, 0, time.UTC)},
+		{"* * * * * *", time.Date(2021, time.January, 30, 10, 15, 21, 0, time.UTC)},
+		{"30 9 * * MON-FRI", time.Date(2021, time.February, 1, 9, 30, 0, 0, time.UTC)},
+		{"0 0 L * *", time.Date(2021, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * MON#1", time.Date(2021, time.February, 1, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * FRI#3", time.Date(2021, time.February, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 12 1 * SUN", time.Date(2021, time.January, 31, 12, 0, 0, 0, time.UTC)},
+		{"0 12 * * 7", time.Date(2021, time.January, 31, 12, 0, 0, 0, time.UTC)},
+		{"@monthly", time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	} {
+		s, err := cron.Parse(c.spec)
+		assert.NoError(t, err, c.spec)
+		assert.Equal(t, c.expected, s.Next(from), c.spec)
+	}
+}
+
+func TestNextKeepsLocation(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	s, err := cron.Parse("@daily")
+	assert.NoError(t, err)
+	next := s.Next(time.Date(2021, time.January, 30, 10, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2021, time.January, 31, 0, 0, 0, 0, loc), next)
+	assert.Equal(t, loc, next.Location())
+}
+
+func TestNextAcrossDaylightSaving(t *testing.T) {
+	t.Parallel()
+
+	loc, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// Clocks jumped from 02:00 to 03:00 on 2021-03-14.
+	s, _ := cron.Parse("30 2 * * *")
+	next := s.Next(time.Date(2021, time.March, 13, 12, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2021, time.March, 14, 3, 30, 0, 0, loc), next)
+	assert.Equal(t, time.Date(2021, time.March, 15, 2, 30, 0, 0, loc), s.Next(next))
+
+	// Clocks went back from 02:00 to 01:00 on 2021-11-07.
+	s, _ = cron.Parse("30 1 * * *")
+	next = s.Next(time.Date(2021, time.November, 6, 12, 0, 0, 0, loc))
+	assert.Equal(t, time.Date(2021, time.November, 7, 5, 30, 0, 0, time.UTC), next.UTC())
+	assert.Equal(t, time.Date(2021, time.November, 8, 1, 30, 0, 0, loc), s.Next(next))
+}
@@ -0,0 +1,347 @@
+// Package ics reads the events of an iCalendar (RFC 5545) file.
+package ics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lovego/kala/utils/iso8601"
+)
+
+var (
+	// ErrBadFormat is returned when parsing fails
+	ErrBadFormat = errors.New("bad iCalendar format")
+)
+
+const (
+	dateLayout     = "20060102"
+	dateTimeLayout = "20060102T150405"
+
+	// The occurrences of a recurring event without COUNT nor UNTIL are expanded
+	// up to expandYears from now.
+	expandYears = 5
+	// Max number of occurrences of a recurring event.
+	maxOccurrences = 10000
+)
+
+// Event is a VEVENT of an iCalendar file.
+type Event struct {
+	Summary string
+	// The event lasts from Start up to, but not including, End.
+	Start time.Time
+	End   time.Time
+}
+
+// recurrence is the RRULE, RDATE and EXDATE properties of a recurring event.
+type recurrence struct {
+	rule    string
+	rdates  []time.Time
+	exdates []time.Time
+	err     error
+}
+
+// Parse returns the events of an iCalendar file, and the errors of the recurring events
+// left out because their recurrence isn't supported.
+// Dates and floating datetimes (without "Z" suffix nor TZID parameter) are in loc.
+// An event without DTEND lasts for its DURATION, or one day if it starts on a date.
+// Events without length, e.g. starting on a datetime without DTEND nor DURATION, are left out.
+// A recurring event is returned once per occurrence. Its RRULE may only have the FREQ,
+// INTERVAL, COUNT and UNTIL parts, and BY parts repeating its start, see ruleStarts.
+func Parse(r io.Reader, loc *time.Location) (events []Event, skipped []error, err error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var event *Event
+	var duration string
+	var allDay bool
+	var rec recurrence
+	// Depth of the components nested in the event, e.g. a VALARM, whose properties
+	// aren't the event's.
+	var nested int
+	for _, line := range lines {
+		name, params, value, err := splitLine(line)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch {
+		case name == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			event, duration, allDay, nested, rec = &Event{}, "", false, 0, recurrence{}
+		case event == nil:
+			continue
+		case name == "BEGIN":
+			nested++
+		case nested > 0:
+			if name == "END" {
+				nested--
+			}
+		case name == "END" && strings.EqualFold(value, "VEVENT"):
+			if err := event.finish(duration, allDay); err != nil {
+				return nil, nil, err
+			}
+			occurrences, err := event.expand(rec, allDay, loc)
+			if err != nil {
+				skipped = append(skipped, fmt.Errorf("recurring iCalendar event %q: %w", event.Summary, err))
+			}
+			if event.End.After(event.Start) {
+				events = append(events, occurrences...)
+			}
+			event = nil
+		case name == "SUMMARY":
+			event.Summary = unescape(value)
+		case name == "DTSTART":
+			if event.Start, err = parseTime(value, params, loc); err != nil {
+				return nil, nil, err
+			}
+			allDay = isDate(value, params)
+		case name == "DTEND":
+			if event.End, err = parseTime(value, params, loc); err != nil {
+				return nil, nil, err
+			}
+		case name == "DURATION":
+			duration = value
+		case name == "RRULE":
+			rec.rule = value
+		case name == "RDATE" || name == "EXDATE":
+			times, err := parseTimes(value, params, loc)
+			if err != nil {
+				rec.err = fmt.Errorf("%s %s: %w", name, value, err)
+			} else if name == "RDATE" {
+				rec.rdates = append(rec.rdates, times...)
+			} else {
+				rec.exdates = append(rec.exdates, times...)
+			}
+		}
+	}
+	if event != nil {
+		return nil, nil, ErrBadFormat
+	}
+	return events, skipped, nil
+}
+
+func (e *Event) finish(duration string, allDay bool) error {
+	if e.Start.IsZero() {
+		return fmt.Errorf("iCalendar event %q has no DTSTART", e.Summary)
+	}
+	if e.End.IsZero() {
+		switch {
+		case duration != "":
+			d, err := iso8601.FromString(strings.TrimPrefix(duration, "+"))
+			if err != nil {
+				return err
+			}
+			e.End = d.Add(e.Start)
+		case allDay:
+			e.End = e.Start.AddDate(0, 0, 1)
+		default:
+			e.End = e.Start
+		}
+	}
+	if e.End.Before(e.Start) {
+		return fmt.Errorf("iCalendar event %q ends before it starts", e.Summary)
+	}
+	return nil
+}
+
+// expand returns the occurrences of the event, which recurs as rec, up to maxOccurrences.
+// It returns no occurrences if the recurrence isn't supported, and only the event
+// if it doesn't recur.
+func (e *Event) expand(rec recurrence, allDay bool, loc *time.Location) ([]Event, error) {
+	if rec.err != nil {
+		return nil, rec.err
+	}
+	starts := []time.Time{e.Start}
+	if rec.rule != "" {
+		var err error
+		if starts, err = ruleStarts(rec.rule, e.Start, loc); err != nil {
+			return nil, err
+		}
+	}
+	starts = append(starts, rec.rdates...)
+
+	days := int(e.End.Sub(e.Start).Hours()/24 + 0.5) //nolint:gomnd
+	events := make([]Event, 0, len(starts))
+	seen := make(map[int64]bool, len(starts))
+	for _, start := range starts {
+		if seen[start.UnixNano()] || containsTime(rec.exdates, start) {
+			continue
+		}
+		seen[start.UnixNano()] = true
+		occurrence := Event{Summary: e.Summary, Start: start, End: start.Add(e.End.Sub(e.Start))}
+		if allDay {
+			occurrence.End = start.AddDate(0, 0, days)
+		}
+		events = append(events, occurrence)
+	}
+	return events, nil
+}
+
+// ruleStarts returns the starts of the occurrences of a RRULE from start.
+// The BYMONTH and BYMONTHDAY parts of a yearly or monthly rule, and the BYDAY part
+// of a weekly one, are only supported if they repeat start,
+// e.g. BYMONTH=12;BYMONTHDAY=25 for a yearly event starting on December 25.
+func ruleStarts(rule string, start time.Time, loc *time.Location) ([]time.Time, error) {
+	parts := make(map[string]string)
+	for _, part := range strings.Split(rule, ";") {
+		i := strings.Index(part, "=")
+		if i < 0 {
+			return nil, ErrBadFormat
+		}
+		parts[strings.ToUpper(part[:i])] = strings.ToUpper(part[i+1:])
+	}
+
+	var years, months, days int
+	switch parts["FREQ"] {
+	case "DAILY":
+		days = 1
+	case "WEEKLY":
+		days = 7
+	case "MONTHLY":
+		months = 1
+	case "YEARLY":
+		years = 1
+	default:
+		return nil, fmt.Errorf("FREQ=%s is not supported", parts["FREQ"])
+	}
+	interval, count := 1, maxOccurrences
+	until := time.Now().AddDate(expandYears, 0, 0)
+	for key, value := range parts {
+		var err error
+		switch key {
+		case "FREQ", "WKST":
+		case "INTERVAL":
+			if interval, err = strconv.Atoi(value); err != nil || interval < 1 {
+				return nil, ErrBadFormat
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(value); err != nil || count < 1 {
+				return nil, ErrBadFormat
+			}
+			until = time.Time{}
+		case "UNTIL":
+			if until, err = parseTime(value, nil, loc); err != nil {
+				return nil, err
+			}
+		case "BYMONTH":
+			if years == 0 || value != strconv.Itoa(int(start.Month())) {
+				return nil, fmt.Errorf("%s=%s is not supported", key, value)
+			}
+		case "BYMONTHDAY":
+			if years+months == 0 || value != strconv.Itoa(start.Day()) {
+				return nil, fmt.Errorf("%s=%s is not supported", key, value)
+			}
+		case "BYDAY":
+			if days != 7 || value != strings.ToUpper(start.Weekday().String()[:2]) {
+				return nil, fmt.Errorf("%s=%s is not supported", key, value)
+			}
+		default:
+			return nil, fmt.Errorf("%s is not supported", key)
+		}
+	}
+
+	var starts []time.Time
+	for k := 0; len(starts) < count && k < maxOccurrences; k++ {
+		t := start.AddDate(k*interval*years, k*interval*months, k*interval*days)
+		if !until.IsZero() && t.After(until) {
+			break
+		}
+		// Months without the day of the start, e.g. February 30, are skipped.
+		if days > 0 || t.Day() == start.Day() {
+			starts = append(starts, t)
+		}
+	}
+	return starts, nil
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, u := range times {
+		if u.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// unfold returns the content lines, joining lines folded with a leading space or tab.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) //nolint:gomnd
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// splitLine splits `NAME;PARAM=VALUE:value` into its parts.
+func splitLine(line string) (name string, params map[string]string, value string, err error) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", nil, "", ErrBadFormat
+	}
+	value = line[i+1:]
+	parts := strings.Split(line[:i], ";")
+	name = strings.ToUpper(parts[0])
+	params = make(map[string]string)
+	for _, param := range parts[1:] {
+		if j := strings.Index(param, "="); j > 0 {
+			params[strings.ToUpper(param[:j])] = strings.Trim(param[j+1:], `"`)
+		}
+	}
+	return name, params, value, nil
+}
+
+func parseTime(value string, params map[string]string, loc *time.Location) (time.Time, error) {
+	if tzid := params["TZID"]; tzid != "" {
+		var err error
+		if loc, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, err
+		}
+	}
+	switch {
+	case isDate(value, params):
+		return time.ParseInLocation(dateLayout, value, loc)
+	case strings.HasSuffix(value, "Z"):
+		return time.Parse(dateTimeLayout+"Z", value)
+	default:
+		return time.ParseInLocation(dateTimeLayout, value, loc)
+	}
+}
+
+// parseTimes parses the comma separated dates or datetimes of a RDATE or EXDATE.
+func parseTimes(value string, params map[string]string, loc *time.Location) ([]time.Time, error) {
+	if params["VALUE"] == "PERIOD" {
+		return nil, errors.New("periods are not supported")
+	}
+	var times []time.Time
+	for _, v := range strings.Split(value, ",") {
+		t, err := parseTime(v, params, loc)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, nil
+}
+
+func isDate(value string, params map[string]string) bool {
+	return params["VALUE"] == "DATE" || len(value) == len(dateLayout)
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
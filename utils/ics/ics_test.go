@@ -0,0 +1,134 @@
+package ics_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lovego/kala/utils/ics"
+	"github.com/stretchr/testify/assert"
+)
+
+const calendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"PRODID:-//Example//Holidays//EN\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:1\r\n" +
+	"DTSTART;VALUE=DATE:20211225\r\n" +
+	"SUMMARY:Christmas Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:2\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20211220T180000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20211220T220000\r\n" +
+	"SUMMARY:Deploy freeze\\, end of\r\n" +
+	"  year\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:3\r\n" +
+	"DTSTART:20211231T230000Z\r\n" +
+	"DURATION:PT2H\r\n" +
+	"SUMMARY:New Year\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"ACTION:DISPLAY\r\n" +
+	"TRIGGER:-PT30M\r\n" +
+	"DURATION:PT15M\r\n" +
+	"REPEAT:2\r\n" +
+	"SUMMARY:Reminder\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:4\r\n" +
+	"DTSTART:20211224T120000Z\r\n" +
+	"SUMMARY:Gift exchange\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	events, skipped, err := ics.Parse(strings.NewReader(calendar), loc)
+	assert.NoError(t, err)
+	assert.Empty(t, skipped)
+	assert.Equal(t, []ics.Event{
+		{
+			Summary: "Christmas Day",
+			Start:   time.Date(2021, time.December, 25, 0, 0, 0, 0, loc),
+			End:     time.Date(2021, time.December, 26, 0, 0, 0, 0, loc),
+		},
+		{
+			Summary: "Deploy freeze, end of year",
+			Start:   time.Date(2021, time.December, 20, 18, 0, 0, 0, berlin),
+			End:     time.Date(2021, time.December, 20, 22, 0, 0, 0, berlin),
+		},
+		{
+			Summary: "New Year",
+			Start:   time.Date(2021, time.December, 31, 23, 0, 0, 0, time.UTC),
+			End:     time.Date(2022, time.January, 1, 1, 0, 0, 0, time.UTC),
+		},
+	}, events)
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []string{
+		"BEGIN:VEVENT\nSUMMARY:No start\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20211225T100000Z\nDTEND:20211225T090000Z\nEND:VEVENT\n",
+		"BEGIN:VEVENT\nDTSTART:20211225T100000Z\n",
+		"BEGIN:VEVENT\nDTSTART:Christmas\nEND:VEVENT\n",
+		"not a calendar\n",
+	} {
+		_, _, err := ics.Parse(strings.NewReader(c), time.UTC)
+		assert.Error(t, err, c)
+	}
+}
+
+func TestParseRecurring(t *testing.T) {
+	t.Parallel()
+
+	events, skipped, err := ics.Parse(strings.NewReader("BEGIN:VCALENDAR\n"+
+		"BEGIN:VEVENT\nDTSTART;VALUE=DATE:20200229\nRRULE:FREQ=YEARLY;COUNT=2\nSUMMARY:Leap day\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nDTSTART;VALUE=DATE:20211225\nRRULE:FREQ=YEARLY;BYMONTH=12;BYMONTHDAY=25;UNTIL=20231231\n"+
+		"EXDATE;VALUE=DATE:20221225\nRDATE;VALUE=DATE:20211226,20221226\nSUMMARY:Christmas\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nDTSTART:20211227T090000Z\nDTEND:20211227T100000Z\nRRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO\n"+
+		"SUMMARY:Standup\nEND:VEVENT\n"+
+		"BEGIN:VEVENT\nDTSTART;VALUE=DATE:20211101\nRRULE:FREQ=YEARLY;BYMONTH=11;BYDAY=1MO\nSUMMARY:Holiday\nEND:VEVENT\n"+
+		"END:VCALENDAR\n"), time.UTC)
+	assert.NoError(t, err)
+
+	day := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+	var starts []time.Time
+	var standups []ics.Event
+	for _, event := range events {
+		if event.Summary == "Standup" {
+			standups = append(standups, event)
+			continue
+		}
+		assert.Equal(t, event.Start.AddDate(0, 0, 1), event.End, event.Summary)
+		starts = append(starts, event.Start)
+	}
+	// The years without a leap day don't count in the occurrences.
+	assert.Equal(t, []time.Time{
+		day(2020, time.February, 29), day(2024, time.February, 29),
+		day(2021, time.December, 25), day(2023, time.December, 25),
+		day(2021, time.December, 26), day(2022, time.December, 26),
+	}, starts)
+
+	// The weekly rule without end is expanded years from now.
+	if assert.True(t, len(standups) > 100) {
+		assert.Equal(t, time.Date(2022, time.January, 10, 9, 0, 0, 0, time.UTC), standups[1].Start)
+		assert.Equal(t, time.Hour, standups[1].End.Sub(standups[1].Start))
+		assert.True(t, standups[len(standups)-1].Start.After(time.Now().AddDate(4, 0, 0)))
+	}
+
+	if assert.Len(t, skipped, 1) {
+		assert.Contains(t, skipped[0].Error(), `"Holiday"`)
+	}
+}
@@ -128,15 +128,51 @@ func (d *Duration) RelativeTo(t time.Time) time.Duration {
 	return after.Sub(t)
 }
 
+// Add adds the duration to t.
+// Years, months, weeks and days are added to the wall clock of t's location,
+// so a P1D duration keeps the time of day across daylight saving transitions,
+// while hours, minutes and seconds are added as elapsed time.
+// See Date for how skipped and repeated wall clock times are resolved.
 func (d *Duration) Add(t time.Time) time.Time {
-	result := addYearsMonths(t, d.Years, d.Months)
-	result = result.AddDate(0, 0, d.Days+d.Weeks*7)
-	result = result.Add(time.Hour * time.Duration(d.Hours))
-	result = result.Add(time.Minute * time.Duration(d.Minutes))
-	result = result.Add(time.Second * time.Duration(d.Seconds))
+	return d.AddN(t, 1)
+}
+
+// AddN adds the duration n times to t. The result is computed from t in one
+// go, so clamped month ends (Jan 31 + P1M is Feb 28) and wall clock times
+// shifted by daylight saving transitions don't accumulate over the n steps.
+func (d *Duration) AddN(t time.Time, n int) time.Time {
+	result := addYearsMonths(t, d.Years*n, d.Months*n)
+	result = Date(
+		result.Year(), result.Month(), result.Day()+(d.Days+d.Weeks*7)*n,
+		t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location(),
+	)
+	result = result.Add(time.Hour * time.Duration(d.Hours*n))
+	result = result.Add(time.Minute * time.Duration(d.Minutes*n))
+	result = result.Add(time.Second * time.Duration(d.Seconds*n))
 	return result
 }
 
+// Next returns the first of start, start + d, start + 2d, ... that is after t.
+func (d *Duration) Next(start, t time.Time) time.Time {
+	if d.IsZero() {
+		return t
+	}
+	if start.After(t) {
+		return start
+	}
+	n := 0
+	if step := d.RelativeTo(start); step > 0 {
+		n = int(t.Sub(start) / step)
+	}
+	for n > 0 && d.AddN(start, n).After(t) {
+		n--
+	}
+	for !d.AddN(start, n).After(t) {
+		n++
+	}
+	return d.AddN(start, n)
+}
+
 func (d *Duration) IsZero() bool {
 	switch {
 	case d.Years != 0:
@@ -161,12 +197,12 @@ func addYearsMonths(t time.Time, addYears int, addMonths int) time.Time {
 	month = ((month - 1) % 12) + 1
 
 	// 构造目标日期，暂时用原日期的日
-	target := time.Date(year, month, t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	target := Date(year, month, t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
 
 	// 如果目标日期溢出（变成了下个月或更远），则设为该月最后一天
 	if target.Month() != month {
 		lastDay := lastDayOfMonth(year, month, t.Location())
-		target = time.Date(year, month, lastDay, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		target = Date(year, month, lastDay, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
 	}
 	return target
 }
@@ -181,3 +217,35 @@ func lastDayOfMonth(year int, month time.Month, loc *time.Location) int {
 	}
 	return nextMonth.AddDate(0, 0, -1).Day()
 }
+
+// Date returns the time of the given wall clock in loc like time.Date does,
+// but resolves daylight saving transitions deterministically:
+// a wall clock time skipped by a transition moves forward by the length of
+// the gap (02:30 becomes 03:30 when clocks jump from 02:00 to 03:00),
+// and a wall clock time repeated by a transition resolves to its first occurrence.
+func Date(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	wall := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+
+	// The offsets in effect a day before and a day after the wall clock time.
+	_, before := wall.Add(-24 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(24 * time.Hour).In(loc).Zone()
+	early := wall.Add(-time.Duration(before) * time.Second).In(loc)
+	late := wall.Add(-time.Duration(after) * time.Second).In(loc)
+
+	switch {
+	case sameWallClock(early, wall):
+		return early
+	case sameWallClock(late, wall):
+		return late
+	default:
+		// Skipped wall clock, read it with the offset before the gap.
+		return early
+	}
+}
+
+func sameWallClock(t, wall time.Time) bool {
+	y, m, d := t.Date()
+	h, min, s := t.Clock()
+	return y == wall.Year() && m == wall.Month() && d == wall.Day() &&
+		h == wall.Hour() && min == wall.Minute() && s == wall.Second() && t.Nanosecond() == wall.Nanosecond()
+}
@@ -138,3 +138,69 @@ func TestRelativeTo(t *testing.T) {
 	t.Logf("Anchor plus duration '%s' is: %s", d.String(), d.Add(anchor).Format(time.RFC822))
 	assert.Equal(t, d.RelativeTo(anchor), time.Hour*24*59)
 }
+
+func TestAddAcrossDaylightSaving(t *testing.T) {
+	t.Parallel()
+
+	loc, err := time.LoadLocation("America/New_York")
+	assert.Nil(t, err)
+	day, _ := iso8601.FromString("P1D")
+	hour, _ := iso8601.FromString("PT1H")
+
+	// Clocks jumped from 02:00 to 03:00 on 2021-03-14.
+	start := time.Date(2021, time.March, 13, 9, 0, 0, 0, loc)
+	assert.Equal(t, time.Date(2021, time.March, 14, 9, 0, 0, 0, loc), day.Add(start))
+	assert.Equal(t, 23*time.Hour, day.RelativeTo(start))
+	assert.Equal(t, time.Hour, hour.RelativeTo(start))
+
+	// Skipped wall clock times move forward by the gap, without drifting later runs.
+	start = time.Date(2021, time.March, 13, 2, 30, 0, 0, loc)
+	assert.Equal(t, time.Date(2021, time.March, 14, 3, 30, 0, 0, loc), day.Add(start))
+	assert.Equal(t, time.Date(2021, time.March, 15, 2, 30, 0, 0, loc), day.AddN(start, 2))
+
+	// Clocks went back from 02:00 to 01:00 on 2021-11-07,
+	// repeated wall clock times resolve to their first occurrence.
+	start = time.Date(2021, time.November, 6, 1, 30, 0, 0, loc)
+	next := day.Add(start)
+	assert.Equal(t, 1, next.Hour())
+	assert.Equal(t, 24*time.Hour, next.Sub(start))
+	_, offset := next.Zone()
+	assert.Equal(t, -4*3600, offset)
+}
+
+func TestDate(t *testing.T) {
+	t.Parallel()
+
+	loc, err := time.LoadLocation("Europe/Berlin")
+	assert.Nil(t, err)
+	assert.Equal(t,
+		time.Date(2021, time.March, 28, 1, 30, 0, 0, time.UTC),
+		iso8601.Date(2021, time.March, 28, 2, 30, 0, 0, loc).UTC(),
+	)
+	assert.Equal(t,
+		time.Date(2021, time.October, 31, 0, 30, 0, 0, time.UTC),
+		iso8601.Date(2021, time.October, 31, 2, 30, 0, 0, loc).UTC(),
+	)
+	assert.Equal(t,
+		time.Date(2021, time.July, 1, 10, 0, 0, 0, time.UTC),
+		iso8601.Date(2021, time.July, 1, 12, 0, 0, 0, loc).UTC(),
+	)
+}
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	month, _ := iso8601.FromString("P1M")
+	start := time.Date(2021, time.January, 31, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, start, month.Next(start, start.Add(-time.Second)))
+	assert.Equal(t, time.Date(2021, time.February, 28, 12, 0, 0, 0, time.UTC), month.Next(start, start))
+	assert.Equal(t,
+		time.Date(2021, time.March, 31, 12, 0, 0, 0, time.UTC),
+		month.Next(start, time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC)),
+	)
+	assert.Equal(t,
+		time.Date(2023, time.August, 31, 12, 0, 0, 0, time.UTC),
+		month.Next(start, time.Date(2023, time.August, 31, 11, 0, 0, 0, time.UTC)),
+	)
+}